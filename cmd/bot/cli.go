@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/crawler"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/logging"
+)
+
+const usage = `用法: bot <命令> [参数]
+
+  run                              启动 Bot 和全部爬虫 (默认)
+  crawl <爬虫> [--once] [--dry-run]  只跑一个爬虫，--once 跑完一轮就退出
+  fetch [--dry-run] <链接>...        直接抓取作品链接 (Pixiv / Yande / ManyACG / Danbooru / Twitter / Fanbox / booru)
+  history export [文件]             导出已发送的 ID，每行一个，默认输出到标准输出
+  history import <文件|->           导入 ID 并合并到 History，- 表示标准输入
+  delete <ID>...                   删除图片和频道里的消息，pixiv_114514_ 或 pixiv_114514* 这样带作品 ID 的前缀删整个作品
+  migrate [up|status]              执行或查看数据库迁移
+
+配置和 bot run 一样从环境变量 / .env 读取
+`
+
+// runCrawl bot crawl <爬虫> [--once] [--dry-run]，不拉取 Telegram 更新，只跑这一个爬虫
+func runCrawl(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	once := fs.Bool("once", false, "跑完一轮就退出")
+	dry := fs.Bool("dry-run", false, "只演练，不发送也不写库")
+
+	// 爬虫名写在参数前后都可以
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" {
+		name = fs.Arg(0)
+	}
+
+	var names []string
+	for _, c := range crawlers {
+		names = append(names, c.name)
+		if c.name != name {
+			continue
+		}
+
+		// 只跑这一个爬虫，按全局演练处理，迁移和 History 都不会写
+		if *dry {
+			cfg.DryRun = []string{"all"}
+		}
+		db, botHandler := setup(cfg)
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		cctx, cdb := dryRun(ctx, cfg, db, name)
+		if *once {
+			cctx = crawler.WithOnce(cctx)
+		}
+		c.start(cctx, cfg, cdb, botHandler)
+		cdb.FlushHistory()
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "未知的爬虫 %q，可选: %s\n", name, strings.Join(names, ", "))
+	os.Exit(2)
+}
+
+// runFetch bot fetch <链接>...，和在聊天里发链接走同一套处理，结果打印到标准输出
+func runFetch(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	dry := fs.Bool("dry-run", false, "只演练，不发送也不写库")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// 链接处理里有直接写 History 的 (如 Yande Pool)，按全局演练处理才不会推回 Worker
+	if *dry {
+		cfg.DryRun = []string{"all"}
+	}
+	db, botHandler := setup(cfg)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	failed := false
+	for _, url := range fs.Args() {
+		name, sent, skipped, err := botHandler.FetchLink(ctx, url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", url, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("✅ %s %s: 发送 %d 张，跳过重复 %d 张\n", name, url, sent, skipped)
+	}
+	db.FlushHistory()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runHistory bot history export|import，History 存在 Worker 里，不需要 BOT_TOKEN
+func runHistory(cfg *config.Config, args []string) {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") || (args[0] == "import" && len(args) < 2) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if cfg.WorkerURL == "" {
+		logging.Fatal("WORKER_URL is missing")
+	}
+
+	db := database.NewD1Client(cfg)
+	db.SyncHistory()
+
+	if args[0] == "export" {
+		out := io.Writer(os.Stdout)
+		if len(args) > 1 && args[1] != "-" {
+			f, err := os.Create(args[1])
+			if err != nil {
+				logging.Fatal("history export failed", "err", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		ids := make([]string, 0, len(db.History))
+		for id := range db.History {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		w := bufio.NewWriter(out)
+		for _, id := range ids {
+			fmt.Fprintln(w, id)
+		}
+		if err := w.Flush(); err != nil {
+			logging.Fatal("history export failed", "err", err)
+		}
+		fmt.Fprintf(os.Stderr, "导出 %d 个 ID\n", len(ids))
+		return
+	}
+
+	in := io.Reader(os.Stdin)
+	if args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			logging.Fatal("history import failed", "err", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		logging.Fatal("history import failed", "err", err)
+	}
+
+	// 和 Worker 的格式一样，逗号或换行分隔都认
+	added := 0
+	for _, id := range strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	}) {
+		if !db.History[id] {
+			db.MarkHistory(id)
+			added++
+		}
+	}
+	db.FlushHistory()
+	fmt.Fprintf(os.Stderr, "新增 %d 个 ID，共 %d 个\n", added, db.HistorySize())
+}
+
+// runDelete bot delete <ID>...，和 /delete 一样进回收站，UNDELETE_HOURS 内还能在 Bot 里 /undelete
+func runDelete(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	_, botHandler := setup(cfg)
+	deleted, notes := botHandler.DeleteImages(context.Background(), args)
+	for _, note := range notes {
+		fmt.Fprintln(os.Stderr, note)
+	}
+	fmt.Printf("🗑️ 共删除 %d 张\n", deleted)
+	if deleted == 0 {
+		os.Exit(1)
+	}
+}
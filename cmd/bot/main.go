@@ -2,70 +2,171 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"time"
+	"my-bot-go/internal/alert"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/crawler"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/migrations"
 	"my-bot-go/internal/telegram"
 	"os"
 	"os/signal"
 )
 
 func main() {
-	log.Println("🚀 Starting Go-MtcACG Bot...")
-	
+	// 日志要在读配置之前设置好，配置里的警告也按同样的格式输出
+	logging.Setup(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
 	cfg := config.Load()
-	if cfg.BotToken == "" {
-		log.Fatal("❌ BOT_TOKEN is missing")
-	}
 
-	db := database.NewD1Client(cfg)
-	db.SyncHistory() 
+	cmd, args := "run", []string(nil)
+	if len(os.Args) > 1 {
+		cmd, args = os.Args[1], os.Args[2:]
+	}
 
-	
-	botHandler, err := telegram.NewBot(cfg, db)
-	if err != nil {
-		log.Fatal(err)
+	switch cmd {
+	case "run":
+		run(cfg)
+	case "migrate":
+		// 只操作数据库，不需要 BOT_TOKEN
+		runMigrate(database.NewD1Client(cfg), args)
+	case "crawl":
+		runCrawl(cfg, args)
+	case "fetch":
+		runFetch(cfg, args)
+	case "history":
+		runHistory(cfg, args)
+	case "delete":
+		runDelete(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
+}
+
+// 爬虫列表，name 和 /stats、DRY_RUN、bot crawl 里用的名字一致，delay 是 bot run 时错开的启动时间
+var crawlers = []struct {
+	name  string
+	delay time.Duration
+	start func(context.Context, *config.Config, *database.D1Client, *telegram.BotHandler)
+}{
+	{"yande", 0, crawler.StartYande},
+	{"pixiv", 5 * time.Minute, crawler.StartPixiv},
+	{"cosine", 10 * time.Minute, crawler.StartCosineTag},
+	{"mtcacg_all", 15 * time.Minute, crawler.StartManyACGAll},
+	{"mtcacg", 20 * time.Minute, crawler.StartManyACG},
+	{"twitter", 25 * time.Minute, crawler.StartTwitter},
+	{"fanbox", 30 * time.Minute, crawler.StartFanbox},
+	{"kemono", 35 * time.Minute, crawler.StartKemono},
+	{"danbooru", 40 * time.Minute, crawler.StartDanbooru},
+	{"booru", 45 * time.Minute, crawler.StartBooru},
+	{"yande_pool", 50 * time.Minute, crawler.StartYandePools},
+	//没必要开了
+	// {"sese", 0, crawler.StartManyACGSese},
+}
+
+// run 启动 Bot 和全部爬虫，不带子命令时也是这个
+func run(cfg *config.Config) {
+	slog.Info("starting bot")
+	// 之后的 error 日志和被站点拦截的警告会提醒管理员
+	alert.Install(cfg)
+
+	db, botHandler := setup(cfg)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	
-	go crawler.StartYande(ctx, cfg, db, botHandler)
-	
-    go func() {
-        time.Sleep(5 * time.Minute)
-        crawler.StartPixiv(ctx, cfg, db, botHandler)
-    }()
+	alert.Start(ctx, botHandler.API)
 
-	//其他爬虫脚本，还为完善。
-	///go crawler.StartDanbooru(ctx, cfg, db, botHandler)///
-	///go crawler.StartKemono(ctx, cfg, db, botHandler)///
+	if cfg.MetricsAddr != "" {
+		go metrics.Serve(ctx, cfg.MetricsAddr, db.HistorySize)
+	}
 
-    go func() {
-        time.Sleep(10 * time.Minute)
-        crawler.StartCosineTag(ctx, cfg, db, botHandler)
-    }()
+	for _, c := range crawlers {
+		c := c
+		metrics.Scheduled(c.name, c.delay)
+		go func() {
+			time.Sleep(c.delay)
+			cctx, cdb := dryRun(ctx, cfg, db, c.name)
+			c.start(cctx, cfg, cdb, botHandler)
+		}()
+	}
 
-    go func() {
-        time.Sleep(15 * time.Minute)
-        crawler.StartManyACGAll(ctx, cfg, db, botHandler)
-    }()
+	metrics.SetReady(true)
+	slog.Info("bot is listening")
+	botHandler.Start(ctx)
 
-	//没必要开了
-	///go crawler.StartManyACGSese(ctx, cfg, db, botHandler)///
+	slog.Info("shutting down, saving history")
+	db.FlushHistory()
+	slog.Info("bye")
+}
 
-    go func() {
-        time.Sleep(20 * time.Minute)
-        crawler.StartManyACG(ctx, cfg, db, botHandler)
-    }()
+// setup 迁移数据库、同步 History 并创建 Bot (不开始拉取更新)，除 migrate 外的子命令共用
+func setup(cfg *config.Config) (*database.D1Client, *telegram.BotHandler) {
+	if cfg.BotToken == "" {
+		logging.Fatal("BOT_TOKEN is missing")
+	}
 
-	log.Println("👂 Bot is listening...")
-	botHandler.Start(ctx)
+	db := database.NewD1Client(cfg)
+	// 全部演练时不动 D1 的表结构
+	if cfg.DryRunFor("all") {
+		slog.Info("dry run, skip migrations")
+	} else if done, err := migrations.Up(db); err != nil {
+		slog.Warn("migration failed", "err", err)
+	} else if len(done) > 0 {
+		slog.Info("applied migrations", "count", len(done))
+	}
+	db.SyncHistory()
+
+	botHandler, err := telegram.NewBot(cfg, db)
+	if err != nil {
+		logging.Fatal("bot init failed", "err", err)
+	}
 
-	log.Println("🛑 Shutting down... Saving history...")
-	db.PushHistory()
-	log.Println("👋 Bye!")
+	crawler.RegisterBooruLinks(cfg, db, botHandler)
+	crawler.RegisterYandePoolLink(db, botHandler)
+	return db, botHandler
+}
+
+// dryRun DRY_RUN 里的爬虫换成带演练标记的 ctx 和不写回的 History 副本
+func dryRun(ctx context.Context, cfg *config.Config, db *database.D1Client, name string) (context.Context, *database.D1Client) {
+	if !cfg.DryRunFor(name) {
+		return ctx, db
+	}
+	return telegram.WithDryRun(ctx), db.DryRun()
+}
+
+func runMigrate(db migrations.DB, args []string) {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		done, err := migrations.Up(db)
+		if err != nil {
+			logging.Fatal("migration failed", "err", err)
+		}
+		slog.Info("applied migrations", "count", len(done))
+	case "status":
+		list, err := migrations.Status(db)
+		if err != nil {
+			logging.Fatal("migration status failed", "err", err)
+		}
+		for _, m := range list {
+			state := "pending"
+			if m.AppliedAt != 0 {
+				state = time.Unix(m.AppliedAt, 0).Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s  %-20s %s\n", m.Version, m.Name, state)
+		}
+	default:
+		logging.Fatal("unknown migrate command, use up or status", "command", cmd)
+	}
 }
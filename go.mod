@@ -3,8 +3,10 @@ module my-bot-go
 go 1.21
 
 require (
-	github.com/go-telegram/bot v1.1.0 
 	github.com/go-resty/resty/v2 v2.11.0
+	github.com/go-telegram/bot v1.1.0
 	github.com/joho/godotenv v1.5.1
-    github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 )
+
+require golang.org/x/net v0.17.0 // indirect
@@ -0,0 +1,337 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"my-bot-go/internal/config"
+
+	"github.com/go-telegram/bot"
+)
+
+// 没有配置 ALERT_CHAT_ID 时私聊这两个管理员
+var admins = []int64{8040798522, 6874581126}
+
+// 日报里最多列出的条目数
+const digestTop = 20
+
+// Notifier 把 error 级别的日志和被站点拦下 (401/403/429) 的警告转发给管理员
+// 同一来源的同一条消息在 dedupe 时间内只提醒一次，每小时最多发 maxPerHour 条
+type Notifier struct {
+	mu         sync.Mutex
+	bot        *bot.Bot
+	chats      []int64
+	dedupe     time.Duration
+	maxPerHour int
+	digestHour int // 每天几点发日报，-1 不发
+
+	last    map[string]*sent     // 来源|消息 -> 上一次提醒
+	recent  []time.Time          // 最近一小时发出的提醒，用于限流
+	muted   map[string]time.Time // 来源 -> 静音到期时间，all 表示全部
+	daily   map[string]int       // 来源|消息 -> 次数，发完日报清零
+	dropped int                  // 因为限流没发出去的
+}
+
+type sent struct {
+	at         time.Time
+	suppressed int // 之后被去重吞掉的次数，下次提醒时带上
+}
+
+func New() *Notifier {
+	return &Notifier{
+		chats:      admins,
+		dedupe:     30 * time.Minute,
+		maxPerHour: 10,
+		digestHour: 9,
+		last:       make(map[string]*sent),
+		muted:      make(map[string]time.Time),
+		daily:      make(map[string]int),
+	}
+}
+
+// std 全局的提醒器，日志 handler 和 /mute 共用
+var std = New()
+
+// Install 读取 ALERT_* 配置，并把提醒挂到全局 slog 上
+// Bot 启动前的错误只计入日报，Start 之后才会实时发送
+func Install(cfg *config.Config) {
+	std.mu.Lock()
+	if cfg.AlertChatID != 0 {
+		std.chats = []int64{cfg.AlertChatID}
+	}
+	if cfg.AlertDedupeMinutes > 0 {
+		std.dedupe = time.Duration(cfg.AlertDedupeMinutes) * time.Minute
+	}
+	if cfg.AlertMaxPerHour > 0 {
+		std.maxPerHour = cfg.AlertMaxPerHour
+	}
+	std.digestHour = cfg.AlertDigestHour
+	std.mu.Unlock()
+
+	slog.SetDefault(slog.New(&handler{next: slog.Default().Handler()}))
+}
+
+// Start 开始实时发送提醒，并按 ALERT_DIGEST_HOUR 每天发一次日报
+func Start(ctx context.Context, b *bot.Bot) {
+	std.mu.Lock()
+	std.bot = b
+	hour := std.digestHour
+	std.mu.Unlock()
+
+	if hour < 0 || hour > 23 {
+		return
+	}
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			std.send(Digest())
+		}
+	}()
+}
+
+// Mute 在 d 时间内不再实时提醒这个来源的错误 (仍然计入日报)，d <= 0 取消静音
+// source 为 all 时静音全部
+func Mute(source string, d time.Duration) {
+	source = strings.ToLower(source)
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if d <= 0 {
+		delete(std.muted, source)
+		return
+	}
+	std.muted[source] = time.Now().Add(d)
+}
+
+// Muted 当前静音中的来源和到期时间
+func Muted() map[string]time.Time {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	now := time.Now()
+	out := make(map[string]time.Time)
+	for source, until := range std.muted {
+		if until.After(now) {
+			out[source] = until
+		} else {
+			delete(std.muted, source)
+		}
+	}
+	return out
+}
+
+// ParseDuration 在 time.ParseDuration 的基础上支持天，如 1d、1d12h
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	var days time.Duration
+	if i := strings.Index(s, "d"); i >= 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		s = s[i+1:]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+// Digest 过去一天的错误汇总，生成后清零
+func Digest() string {
+	std.mu.Lock()
+	daily, dropped := std.daily, std.dropped
+	std.daily, std.dropped = make(map[string]int), 0
+	std.mu.Unlock()
+
+	if len(daily) == 0 {
+		return "📋 每日报告：过去 24 小时没有错误喵~"
+	}
+
+	keys := make([]string, 0, len(daily))
+	total := 0
+	for k, n := range daily {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if daily[keys[i]] != daily[keys[j]] {
+			return daily[keys[i]] > daily[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📋 每日报告：过去 24 小时共 %d 条错误喵~\n", total)
+	for i, k := range keys {
+		if i == digestTop {
+			fmt.Fprintf(&sb, "… 还有 %d 种\n", len(keys)-digestTop)
+			break
+		}
+		source, msg, _ := strings.Cut(k, "|")
+		fmt.Fprintf(&sb, "×%d [%s] %s\n", daily[k], source, msg)
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "⚠️ 超过每小时上限没发出的提醒 %d 条\n", dropped)
+	}
+	for source, until := range Muted() {
+		fmt.Fprintf(&sb, "🔕 %s 静音到 %s\n", source, until.Format("01-02 15:04"))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// notify 记一次错误，没有静音、去重和限流时发出提醒
+func (n *Notifier) notify(source, msg, detail string) {
+	key := source + "|" + msg
+	now := time.Now()
+
+	n.mu.Lock()
+	n.daily[key]++
+	if n.bot == nil || n.isMuted(source, now) {
+		n.mu.Unlock()
+		return
+	}
+	prev := n.last[key]
+	if prev != nil && now.Sub(prev.at) < n.dedupe {
+		prev.suppressed++
+		n.mu.Unlock()
+		return
+	}
+
+	cutoff := now.Add(-time.Hour)
+	for len(n.recent) > 0 && n.recent[0].Before(cutoff) {
+		n.recent = n.recent[1:]
+	}
+	if len(n.recent) >= n.maxPerHour {
+		n.dropped++
+		n.mu.Unlock()
+		return
+	}
+	n.recent = append(n.recent, now)
+	n.last[key] = &sent{at: now}
+	n.mu.Unlock()
+
+	text := fmt.Sprintf("🚨 [%s] %s", source, msg)
+	if detail != "" {
+		text += "\n" + detail
+	}
+	if prev != nil && prev.suppressed > 0 {
+		text += fmt.Sprintf("\n\n(上次提醒后又出现了 %d 次)", prev.suppressed)
+	}
+	go n.send(text)
+}
+
+func (n *Notifier) isMuted(source string, now time.Time) bool {
+	for _, s := range []string{source, "all"} {
+		if until, ok := n.muted[s]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Notifier) send(text string) {
+	n.mu.Lock()
+	b, chats := n.bot, n.chats
+	n.mu.Unlock()
+	if b == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, chatID := range chats {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text}); err != nil {
+			// source=alert 的日志不会再触发提醒，避免发送失败时循环
+			slog.Warn("alert send failed", "source", "alert", "chat_id", chatID, "err", err)
+		}
+	}
+}
+
+// 站点拦截的状态码，Cloudflare 挑战页也是 403
+var blockedStatus = regexp.MustCompile(`status (401|403|429)\b`)
+
+// handler 包一层 slog.Handler，日志照常输出，需要提醒的另外交给 std
+type handler struct {
+	next  slog.Handler
+	attrs []slog.Attr // With 带上的属性，用来找 source
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	// 日志级别设成 error 时，被拦截的警告也要能触发提醒
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	source := "bot"
+	var detail []string
+	blocked := false
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		switch a.Key {
+		case "source":
+			source = strings.ToLower(v.String())
+			continue
+		case "status":
+			if code := v.String(); code == "401" || code == "403" || code == "429" {
+				blocked = true
+			}
+		case "err":
+			if blockedStatus.MatchString(v.String()) {
+				blocked = true
+			}
+		}
+		detail = append(detail, a.Key+"="+v.String())
+	}
+	if source == "alert" || (r.Level < slog.LevelError && !blocked) {
+		return err
+	}
+
+	text := strings.Join(detail, "\n")
+	if runes := []rune(text); len(runes) > 1000 {
+		text = string(runes[:1000]) + "…"
+	}
+	std.notify(source, r.Message, text)
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{
+		next:  h.next.WithAttrs(attrs),
+		attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...),
+	}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), attrs: h.attrs}
+}
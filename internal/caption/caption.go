@@ -0,0 +1,333 @@
+package caption
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/tagmap"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// MaxLen Telegram 图片说明的上限，按解析实体后的 UTF-16 长度计算
+const MaxLen = 1024
+
+// 输出格式
+const (
+	ModePlain    = ""
+	ModeHTML     = "HTML"
+	ModeMarkdown = "MarkdownV2"
+)
+
+// 内置的默认模板，没有对应的 <source>.tmpl 时使用
+const defaultTemplate = `{{esc .Name}}: {{if .Title}}{{esc .Title}}{{else}}{{esc .ID}}{{end}}{{page .}}
+{{- if .Artist}}
+Artist: {{esc .Artist}}{{end}}
+{{- if .Copyrights}}
+Copyright: {{join " " .Copyrights}}{{end}}
+{{- if .Characters}}
+Character: {{join " " .Characters}}{{end}}
+{{- if .Tags}}
+Tags: {{hashtags .Tags}}{{end}}
+{{- if .Note}}
+{{esc .Note}}{{end}}
+{{- if .URL}}
+Source: {{link .URL .URL}}{{end}}`
+
+// 来源的显示名，没列出的首字母大写
+var names = map[string]string{
+	"pixiv":        "Pixiv",
+	"mtcacg":       "MtcACG",
+	"manyacg":      "MtcACG",
+	"manyacg_sese": "MtcACG",
+	"yande":        "Yande",
+	"danbooru":     "Danbooru",
+	"twitter":      "Twitter",
+	"fanbox":       "Fanbox",
+	"kemono":       "Kemono",
+}
+
+// Data 模板里可用的字段，字符串都是原文，HTML / MarkdownV2 模式下用 esc 输出
+type Data struct {
+	Source     string // 来源 key，如 pixiv
+	Name       string // 显示名，如 Pixiv
+	ID         string // 作品 ID，不带来源前缀
+	PostID     string
+	Title      string
+	Artist     string
+	ArtistID   string
+	Rating     string
+	URL        string
+	Note       string
+	Tags       []string
+	Characters []string // 只有 danbooru 这类带分类的站点才有
+	Copyrights []string
+	Page       int // 从 1 开始
+	Pages      int // 0 表示不分页
+	Width      int
+	Height     int
+}
+
+// FromMeta 从入库的元数据生成模板数据
+func FromMeta(meta database.ImageMeta) Data {
+	artworkID, pageIndex := meta.Artwork()
+	id := artworkID
+	if i := strings.LastIndex(id, "_"); i >= 0 {
+		id = id[i+1:]
+	}
+
+	name, ok := names[strings.ToLower(meta.Source)]
+	if !ok && meta.Source != "" {
+		name = strings.ToUpper(meta.Source[:1]) + meta.Source[1:]
+	}
+
+	var characters, copyrights []string
+	for _, t := range meta.Tags {
+		switch t.Kind {
+		case database.TagCharacter:
+			characters = append(characters, t.Name)
+		case database.TagCopyright:
+			copyrights = append(copyrights, t.Name)
+		}
+	}
+
+	return Data{
+		Characters: characters,
+		Copyrights: copyrights,
+		Source:     meta.Source,
+		Name:       name,
+		ID:         id,
+		PostID:     meta.PostID,
+		Title:      meta.Title,
+		Artist:     meta.Artist,
+		ArtistID:   meta.ArtistID,
+		Rating:     meta.Rating,
+		URL:        meta.SourceURL,
+		Note:       meta.Note,
+		Tags:       meta.TagNames(),
+		Page:       pageIndex + 1,
+		Pages:      meta.PageCount,
+		Width:      meta.Width,
+		Height:     meta.Height,
+	}
+}
+
+// Engine 按来源选择模板渲染说明文字
+// 模板目录下 default.tmpl 替换内置模板，<source>.tmpl 只对该来源生效
+type Engine struct {
+	mode      string
+	fallback  *template.Template
+	templates map[string]*template.Template
+}
+
+func New(cfg *config.Config) *Engine {
+	e := &Engine{mode: cfg.CaptionMode, templates: make(map[string]*template.Template)}
+	if e.mode != ModeHTML && e.mode != ModeMarkdown {
+		e.mode = ModePlain
+	}
+	e.fallback = template.Must(template.New("default").Funcs(funcs).Parse(defaultTemplate))
+
+	if cfg.CaptionDir == "" {
+		return e
+	}
+	files, _ := filepath.Glob(filepath.Join(cfg.CaptionDir, "*.tmpl"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			slog.Warn("caption template read failed", "file", f, "err", err)
+			continue
+		}
+		source := strings.ToLower(strings.TrimSuffix(filepath.Base(f), ".tmpl"))
+		t, err := template.New(source).Funcs(funcs).Parse(string(data))
+		if err != nil {
+			slog.Warn("caption template parse failed", "file", f, "err", err)
+			continue
+		}
+		if source == "default" {
+			e.fallback = t
+		} else {
+			e.templates[source] = t
+		}
+	}
+	if len(files) > 0 {
+		slog.Info("loaded caption templates", "count", len(files), "dir", cfg.CaptionDir)
+	}
+	return e
+}
+
+// Render 生成发送用的说明文字和对应的 ParseMode
+// 超过长度上限时先从末尾逐个去掉标签，还不够就退回纯文本截断
+func (e *Engine) Render(meta database.ImageMeta) (string, models.ParseMode) {
+	d := FromMeta(meta)
+	t := e.templates[strings.ToLower(d.Source)]
+	if t == nil {
+		t = e.fallback
+	}
+
+	for {
+		text, err := e.execute(t, d, e.mode)
+		if err != nil {
+			slog.Warn("caption template failed", "template", t.Name(), "post_id", meta.PostID, "err", err)
+			if t == e.fallback {
+				return Truncate(meta.Caption, MaxLen), ""
+			}
+			t = e.fallback
+			continue
+		}
+		if e.visibleLen(t, d, text) <= MaxLen {
+			return text, models.ParseMode(e.mode)
+		}
+		if len(d.Tags) == 0 {
+			break
+		}
+		d.Tags = d.Tags[:len(d.Tags)-1]
+	}
+
+	text, _ := e.execute(t, d, ModePlain)
+	return Truncate(text, MaxLen), ""
+}
+
+// Plain 纯文本版本，写进 images.caption 给前端展示
+func (e *Engine) Plain(meta database.ImageMeta) string {
+	d := FromMeta(meta)
+	t := e.templates[strings.ToLower(d.Source)]
+	if t == nil {
+		t = e.fallback
+	}
+	text, err := e.execute(t, d, ModePlain)
+	if err != nil {
+		text, _ = e.execute(e.fallback, d, ModePlain)
+	}
+	return text
+}
+
+func (e *Engine) execute(t *template.Template, d Data, mode string) (string, error) {
+	var buf bytes.Buffer
+	// 模板函数需要知道当前的输出格式，用 Clone 绑定一份
+	clone, err := t.Clone()
+	if err != nil {
+		return "", err
+	}
+	clone.Funcs(modeFuncs(mode))
+	if err := clone.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// funcs 只用于解析，执行时由 modeFuncs 按输出格式替换
+var funcs = modeFuncs(ModePlain)
+
+func modeFuncs(mode string) template.FuncMap {
+	return template.FuncMap{
+		"esc": func(s string) string { return Escape(s, mode) },
+		"hashtags": func(tags []string) string {
+			return Escape(tagmap.HashTags(tags), mode)
+		},
+		"truncate": func(n int, s string) string { return Truncate(s, n) },
+		"link":     func(text, url string) string { return Link(text, url, mode) },
+		"bold":     func(s string) string { return wrap(s, mode, "<b>", "</b>", "*") },
+		"italic":   func(s string) string { return wrap(s, mode, "<i>", "</i>", "_") },
+		"code":     func(s string) string { return wrap(s, mode, "<code>", "</code>", "`") },
+		"page": func(d Data) string {
+			if d.Pages <= 1 {
+				return ""
+			}
+			return Escape(fmt.Sprintf(" [P%d/%d]", d.Page, d.Pages), mode)
+		},
+		"join": func(sep string, list []string) string { return Escape(strings.Join(list, sep), mode) },
+	}
+}
+
+var markdownSpecial = regexp.MustCompile("([_*\\[\\]()~`>#+\\-=|{}.!\\\\])")
+
+// Escape 按输出格式转义原文
+func Escape(s, mode string) string {
+	switch mode {
+	case ModeHTML:
+		return html.EscapeString(s)
+	case ModeMarkdown:
+		return markdownSpecial.ReplaceAllString(s, "\\$1")
+	}
+	return s
+}
+
+// Link 生成链接，纯文本模式下只输出地址
+func Link(text, url, mode string) string {
+	switch mode {
+	case ModeHTML:
+		return `<a href="` + html.EscapeString(url) + `">` + html.EscapeString(text) + `</a>`
+	case ModeMarkdown:
+		u := strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(url)
+		return "[" + Escape(text, mode) + "](" + u + ")"
+	}
+	if text == "" || text == url {
+		return url
+	}
+	return text + " " + url
+}
+
+func wrap(s, mode, open, close, md string) string {
+	switch mode {
+	case ModeHTML:
+		return open + html.EscapeString(s) + close
+	case ModeMarkdown:
+		return md + Escape(s, mode) + md
+	}
+	return s
+}
+
+// Truncate 按 UTF-16 长度截断，超出时以 … 结尾
+func Truncate(s string, n int) string {
+	if utf16Len(s) <= n {
+		return s
+	}
+	count := 0
+	for i, r := range s {
+		count += runeLen(r)
+		if count > n-1 {
+			return s[:i] + "…"
+		}
+	}
+	return s
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// visibleLen 去掉标记后实际显示的长度，MarkdownV2 和 HTML 显示的内容相同，按 HTML 版本计算
+func (e *Engine) visibleLen(t *template.Template, d Data, text string) int {
+	if e.mode == ModePlain {
+		return utf16Len(text)
+	}
+	if e.mode == ModeMarkdown {
+		if h, err := e.execute(t, d, ModeHTML); err == nil {
+			text = h
+		}
+	}
+	return utf16Len(html.UnescapeString(htmlTag.ReplaceAllString(text, "")))
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen(r)
+	}
+	return n
+}
+
+// runeLen 辅助平面的字符 (大部分 emoji) 在 UTF-16 里占两个单位
+func runeLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -1,11 +1,13 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 
+	"my-bot-go/internal/rating"
+
 	"github.com/joho/godotenv"
 )
 
@@ -14,9 +16,64 @@ type KemonoCreator struct {
 	UserIDs []string 
 }
 
+// BooruSite 一个通用 booru 站点，Dialect 决定 API 格式: moebooru / danbooru / gelbooru
+type BooruSite struct {
+	Name     string
+	Dialect  string
+	BaseURL  string
+	Tags     string
+	Limit    int
+	Username string // gelbooru 为 user_id
+	APIKey   string
+}
+
+// 常见站点的默认方言和地址，配置里只写名字就能用
+var booruPresets = map[string]BooruSite{
+	"konachan":  {Dialect: "moebooru", BaseURL: "https://konachan.net"},
+	"gelbooru":  {Dialect: "gelbooru", BaseURL: "https://gelbooru.com"},
+	"safebooru": {Dialect: "gelbooru", BaseURL: "https://safebooru.org"},
+}
+
+// RouteRule 一条分流规则，条件留空表示不限制，同一条规则里的条件需要同时满足
+type RouteRule struct {
+	Name     string
+	Chats    []int64
+	Sources  []string
+	Ratings  []string
+	Tags     []string // 命中任意一个即可
+	Artists  []string
+	Aspect   string  // landscape / portrait / square
+	MinRatio float64 // 宽/高 下限，比如壁纸频道用 1.6
+	Mirror   bool    // 镜像规则：命中后继续匹配后面的规则，并且不影响默认频道
+}
+
+// ContentFilter 下载前按元数据过滤，数值为 0 表示不限制
+type ContentFilter struct {
+	IncludeTags  []string // 非空时至少命中一个
+	ExcludeTags  []string
+	BlockArtists []string
+	MinWidth     int
+	MinHeight    int
+	MinRatio     float64 // 宽/高
+	MaxRatio     float64
+}
+
 type Config struct {
 	BotToken       string
 	ChannelID      int64
+	NSFWChannelID  int64  // 可选，分级达到 NSFWMinRating 的图发到这里
+	NSFWMinRating  string // questionable / explicit
+	ReviewChatID   int64    // 可选，配置后爬到的图先发到这个群审核
+	ReviewSources  []string // 只审核这些来源，留空为全部
+	UndeleteHours  int      // /delete 之后多少小时内可以 /undelete
+	InlineR18Users []int64  // 内联搜索能看到 R-18 的用户 (管理员默认可以)
+	MetricsAddr    string   // /healthz /readyz /metrics 的监听地址，留空不开
+	AlertChatID        int64 // 错误提醒发到这个群，留空私聊管理员
+	AlertDedupeMinutes int   // 同一条错误多少分钟内只提醒一次
+	AlertMaxPerHour    int   // 每小时最多发几条提醒
+	AlertDigestHour    int   // 每天几点发错误日报，-1 不发
+	DryRun         []string // 只演练不发送的爬虫，all 表示全部
+	DryRunDownload bool     // 演练时也下载图片，默认只看元数据
 	CF_AccountID   string
 	CF_APIToken    string
 	D1_DatabaseID  string
@@ -26,19 +83,48 @@ type Config struct {
 	PixivCrawlRange   int 
 	YandeLimit     int
 	YandeTags      string
+	YandePoolIDs   []string
 	PixivArtistIDs []string
 	FanboxCookie  string
+	FanboxCreatorIDs []string
+	FanboxLimit      int
 
 	KemonoCreators []KemonoCreator
+	KemonoLimit    int  // 普通模式下每个作者每轮最多处理的帖子数
+	KemonoBackfill bool // 首轮把作者的全部历史帖子都翻一遍
+	KemonoRating   string // Kemono 没有分级字段，标签里没写时用这个
 
     
 	DanbooruTags  string
 	DanbooruLimit int
+	DanbooruMaxPages int // 每轮最多向前翻几页 (page=b<id>)
 	DanbooruUsername string 
 	DanbooruAPIKey   string 
 
 	CosineTags        []string 
 	CosineLimitPerTag int      
+
+	TwitterCookie        string
+	TwitterCT0           string
+	TwitterUsers         []string // 巡逻媒体时间线的账号 (screen_name)
+	TwitterLikesUsers    []string // 巡逻点赞列表的账号 (screen_name)
+	TwitterLimit         int
+	TwitterQueryID       string // TweetDetail
+	TwitterUserQueryID   string // UserByScreenName
+	TwitterMediaQueryID  string // UserMedia
+	TwitterLikesQueryID  string // Likes
+
+	BooruSites []BooruSite
+
+	RouteRules []RouteRule
+
+	TagDictFile string // 标签别名/翻译表，见 internal/tagmap
+
+	CaptionDir  string // 说明文字模板目录，见 internal/caption
+	CaptionMode string // 空 / HTML / MarkdownV2
+
+	Filter        ContentFilter            // 全局过滤规则
+	SourceFilters map[string]ContentFilter // 按来源追加的规则，与全局规则同时生效
 }
 
 func Load() *Config {
@@ -47,7 +133,65 @@ func Load() *Config {
 	channelIDStr := getEnv("CHANNEL_ID", "")
 	channelID, err := strconv.ParseInt(channelIDStr, 10, 64)
 	if err != nil {
-		log.Printf("⚠️ Warning: Invalid CHANNEL_ID: %v", err)
+		slog.Warn("invalid CHANNEL_ID", "err", err)
+	}
+
+	// 不配置就全部发到主频道
+	var nsfwChannelID int64
+	if v := getEnv("NSFW_CHANNEL_ID", ""); v != "" {
+		nsfwChannelID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			slog.Warn("invalid NSFW_CHANNEL_ID", "err", err)
+		}
+	}
+
+	// 不配置就直接发布
+	var reviewChatID int64
+	if v := getEnv("REVIEW_CHAT_ID", ""); v != "" {
+		reviewChatID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			slog.Warn("invalid REVIEW_CHAT_ID", "err", err)
+		}
+	}
+
+	undeleteHours, _ := strconv.Atoi(getEnv("UNDELETE_HOURS", "24"))
+
+	var alertChatID int64
+	if v := getEnv("ALERT_CHAT_ID", ""); v != "" {
+		alertChatID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			slog.Warn("invalid ALERT_CHAT_ID", "err", err)
+		}
+	}
+	alertDedupe, _ := strconv.Atoi(getEnv("ALERT_DEDUPE_MINUTES", "30"))
+	alertMaxPerHour, _ := strconv.Atoi(getEnv("ALERT_MAX_PER_HOUR", "10"))
+	alertDigestHour, err := strconv.Atoi(getEnv("ALERT_DIGEST_HOUR", "9"))
+	if err != nil {
+		alertDigestHour = 9
+	}
+
+	// DRY_RUN=true 全部演练，DRY_RUN=danbooru,booru 只演练这些爬虫 (名字和 /stats 里的一样)
+	var dryRun []string
+	switch v := strings.ToLower(strings.TrimSpace(getEnv("DRY_RUN", ""))); v {
+	case "", "false", "0", "no":
+	case "true", "1", "yes", "all":
+		dryRun = []string{"all"}
+	default:
+		dryRun = splitList(v)
+	}
+	dryRunDownload, _ := strconv.ParseBool(getEnv("DRY_RUN_DOWNLOAD", "false"))
+	if len(dryRun) > 0 {
+		slog.Warn("dry run enabled, nothing will be sent or saved", "targets", dryRun, "download", dryRunDownload)
+	}
+
+	var inlineR18Users []int64
+	for _, v := range splitList(getEnv("INLINE_R18_USERS", "")) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			slog.Warn("invalid INLINE_R18_USERS entry", "value", v)
+			continue
+		}
+		inlineR18Users = append(inlineR18Users, id)
 	}
 
 	pixivLimit, _ := strconv.Atoi(getEnv("PIXIV_LIMIT", "3"))
@@ -86,6 +230,19 @@ func Load() *Config {
 	cfg := &Config{
 		BotToken:       getEnv("BOT_TOKEN", ""),
 		ChannelID:      channelID,
+		NSFWChannelID:  nsfwChannelID,
+		NSFWMinRating:  rating.Normalize(getEnv("NSFW_MIN_RATING", "explicit"), rating.Explicit),
+		ReviewChatID:   reviewChatID,
+		ReviewSources:  splitList(strings.ToLower(getEnv("REVIEW_SOURCES", ""))),
+		UndeleteHours:  undeleteHours,
+		InlineR18Users: inlineR18Users,
+		MetricsAddr:    getEnv("METRICS_ADDR", ""),
+		AlertChatID:        alertChatID,
+		AlertDedupeMinutes: alertDedupe,
+		AlertMaxPerHour:    alertMaxPerHour,
+		AlertDigestHour:    alertDigestHour,
+		DryRun:             dryRun,
+		DryRunDownload:     dryRunDownload,
 		CF_AccountID:   getEnv("CLOUDFLARE_ACCOUNT_ID", ""),
 		CF_APIToken:    getEnv("CLOUDFLARE_API_TOKEN", ""),
 		D1_DatabaseID:  getEnv("D1_DATABASE_ID", ""),
@@ -96,16 +253,24 @@ func Load() *Config {
 		PixivCrawlRange:   pixivRange,
 		YandeLimit:     yandeLimit,
 		YandeTags:      getEnv("YANDE_TAGS", "order:random"),
+		YandePoolIDs:   splitList(getEnv("YANDE_POOL_IDS", "")),
 		PixivArtistIDs: artistIDs,
 		CosineTags:        cosineTags,
 		CosineLimitPerTag: cosineLimit,
 	}
 
-	// 解析 Kemono 多平台配置，#未完善
+	// 解析 Kemono/Coomer 多平台配置
 	// 例：
-	// KEMONO_SERVICES=fanbox,patreon
+	// KEMONO_SERVICES=fanbox,patreon,onlyfans
 	// KEMONO_FANBOX_USER_IDS=123,456
 	// KEMONO_PATREON_USER_IDS=111,222
+	// KEMONO_LIMIT=5
+	// KEMONO_BACKFILL=true
+	// KEMONO_RATING=questionable
+	kemonoLimit, _ := strconv.Atoi(getEnv("KEMONO_LIMIT", "5"))
+	cfg.KemonoLimit = kemonoLimit
+	cfg.KemonoBackfill, _ = strconv.ParseBool(getEnv("KEMONO_BACKFILL", "false"))
+	cfg.KemonoRating = rating.Normalize(getEnv("KEMONO_RATING", "questionable"), rating.Questionable)
 	servicesEnv := getEnv("KEMONO_SERVICES", "")
 	if servicesEnv != "" {
 		services := strings.Split(servicesEnv, ",")
@@ -137,16 +302,138 @@ func Load() *Config {
 		}
 	}
 
-	// 解析 Danbooru 配置。#未完善
+	// 解析 Danbooru 配置。
 	// 例：
-	// DANBOORU_TAGS=order:rank date:today -animated
+	// DANBOORU_TAGS=rating:general -animated (按 ID 排序往前翻页，带 order: 的查询只看第一页)
 	// DANBOORU_LIMIT=5
+	// DANBOORU_MAX_PAGES=5
 	danLimit, _ := strconv.Atoi(getEnv("DANBOORU_LIMIT", "3"))
-	cfg.DanbooruTags = getEnv("DANBOORU_TAGS", "order:rank -animated")
+	danMaxPages, _ := strconv.Atoi(getEnv("DANBOORU_MAX_PAGES", "5"))
+	cfg.DanbooruMaxPages = danMaxPages
+	cfg.DanbooruTags = getEnv("DANBOORU_TAGS", "rating:general -animated")
 	cfg.DanbooruLimit = danLimit
 	cfg.DanbooruUsername = getEnv("DANBOORU_USERNAME", "")
 	cfg.DanbooruAPIKey = getEnv("DANBOORU_APIKEY", "")
 
+	// 解析 Fanbox 配置
+	// 例：
+	// FANBOX_COOKIE=FANBOXSESSID=xxx
+	// FANBOX_CREATOR_IDS=creatorA,creatorB
+	fanboxLimit, _ := strconv.Atoi(getEnv("FANBOX_LIMIT", "5"))
+	cfg.FanboxCreatorIDs = splitList(getEnv("FANBOX_CREATOR_IDS", ""))
+	cfg.FanboxLimit = fanboxLimit
+
+	// 解析 Twitter/X 配置
+	// 例：
+	// TWITTER_COOKIE=auth_token=xxx; ct0=yyy
+	// TWITTER_CT0=yyy
+	// TWITTER_USERS=artist_a,artist_b
+	// TWITTER_LIKES_USERS=my_account
+	// GraphQL Query ID 会随 X 前端更新而失效，失效时在环境变量里替换即可
+	twitterLimit, _ := strconv.Atoi(getEnv("TWITTER_LIMIT", "20"))
+	cfg.TwitterCookie = getEnv("TWITTER_COOKIE", "")
+	cfg.TwitterCT0 = getEnv("TWITTER_CT0", "")
+	cfg.TwitterUsers = splitList(getEnv("TWITTER_USERS", ""))
+	cfg.TwitterLikesUsers = splitList(getEnv("TWITTER_LIKES_USERS", ""))
+	cfg.TwitterLimit = twitterLimit
+	cfg.TwitterQueryID = getEnv("TWITTER_QUERY_ID", "zJvfJs3gSbrKKqvJBGCbPQ")
+	cfg.TwitterUserQueryID = getEnv("TWITTER_USER_QUERY_ID", "xmU6X_CKVnQ5lSrCbAmJsg")
+	cfg.TwitterMediaQueryID = getEnv("TWITTER_MEDIA_QUERY_ID", "BGmkmGDG0kZPM-aoQtNTTw")
+	cfg.TwitterLikesQueryID = getEnv("TWITTER_LIKES_QUERY_ID", "IohM3gxQHfvWePH5E3KuNA")
+
+	// 解析通用 booru 站点配置
+	// 例：
+	// BOORU_SITES=konachan,gelbooru
+	// BOORU_KONACHAN_TAGS=landscape -rating:e
+	// BOORU_KONACHAN_LIMIT=5
+	// 非预置站点需要写方言和地址：
+	// BOORU_SITES=lolibooru
+	// BOORU_LOLIBOORU_DIALECT=moebooru
+	// BOORU_LOLIBOORU_URL=https://lolibooru.moe
+	for _, name := range splitList(getEnv("BOORU_SITES", "")) {
+		name = strings.ToLower(name)
+		prefix := "BOORU_" + strings.ToUpper(name) + "_"
+
+		site := booruPresets[name]
+		site.Name = name
+		site.Dialect = getEnv(prefix+"DIALECT", site.Dialect)
+		site.BaseURL = strings.TrimRight(getEnv(prefix+"URL", site.BaseURL), "/")
+		site.Tags = getEnv(prefix+"TAGS", "")
+		site.Limit, _ = strconv.Atoi(getEnv(prefix+"LIMIT", "3"))
+		site.Username = getEnv(prefix+"USERNAME", "")
+		site.APIKey = getEnv(prefix+"APIKEY", "")
+
+		if site.Dialect == "" || site.BaseURL == "" {
+			slog.Warn("booru site has no dialect or url, ignored", "site", name)
+			continue
+		}
+		cfg.BooruSites = append(cfg.BooruSites, site)
+	}
+
+	cfg.TagDictFile = getEnv("TAG_DICT_FILE", "tag_dict.txt")
+	cfg.CaptionDir = getEnv("CAPTION_TEMPLATE_DIR", "captions")
+	cfg.CaptionMode = getEnv("CAPTION_PARSE_MODE", "")
+
+	// 解析内容过滤规则
+	// 例：
+	// FILTER_EXCLUDE_TAGS=guro,ai-generated,comic
+	// FILTER_BLOCK_ARTISTS=someone
+	// FILTER_MIN_WIDTH=1000
+	// FILTER_MIN_RATIO=0.4
+	// FILTER_MAX_RATIO=2.5
+	// 按来源追加：FILTER_<SOURCE>_INCLUDE_TAGS / _EXCLUDE_TAGS / ...
+	// FILTER_SOURCES=danbooru,twitter
+	// FILTER_DANBOORU_EXCLUDE_TAGS=comic,4koma
+	cfg.Filter = loadFilter("FILTER_")
+	cfg.SourceFilters = make(map[string]ContentFilter)
+	for _, source := range splitList(getEnv("FILTER_SOURCES", "")) {
+		cfg.SourceFilters[strings.ToLower(source)] = loadFilter("FILTER_" + strings.ToUpper(source) + "_")
+	}
+
+	// 解析分流规则，按 ROUTE_RULES 的顺序匹配
+	// 第一条命中的普通规则决定目标频道，镜像规则命中就额外抄送一份
+	// 一条都没命中时走 CHANNEL_ID / NSFW_CHANNEL_ID
+	// 例：
+	// ROUTE_RULES=nsfw,wallpaper,archive
+	// ROUTE_NSFW_RATINGS=explicit
+	// ROUTE_NSFW_CHATS=-100111
+	// ROUTE_WALLPAPER_ASPECT=landscape
+	// ROUTE_WALLPAPER_MIN_RATIO=1.6
+	// ROUTE_WALLPAPER_CHATS=-100222
+	// ROUTE_ARCHIVE_MIRROR=true
+	// ROUTE_ARCHIVE_CHATS=-100333
+	// 其他条件：ROUTE_<NAME>_SOURCES / _TAGS / _ARTISTS
+	for _, name := range splitList(getEnv("ROUTE_RULES", "")) {
+		prefix := "ROUTE_" + strings.ToUpper(name) + "_"
+
+		rule := RouteRule{
+			Name:    strings.ToLower(name),
+			Sources: splitList(strings.ToLower(getEnv(prefix+"SOURCES", ""))),
+			Tags:    splitList(getEnv(prefix+"TAGS", "")),
+			Artists: splitList(getEnv(prefix+"ARTISTS", "")),
+			Aspect:  strings.ToLower(getEnv(prefix+"ASPECT", "")),
+		}
+		for _, r := range splitList(getEnv(prefix+"RATINGS", "")) {
+			rule.Ratings = append(rule.Ratings, rating.Normalize(r, rating.Safe))
+		}
+		rule.MinRatio, _ = strconv.ParseFloat(getEnv(prefix+"MIN_RATIO", "0"), 64)
+		rule.Mirror, _ = strconv.ParseBool(getEnv(prefix+"MIRROR", "false"))
+		for _, c := range splitList(getEnv(prefix+"CHATS", "")) {
+			chatID, err := strconv.ParseInt(c, 10, 64)
+			if err != nil {
+				slog.Warn("route has invalid chat id", "route", name, "chat_id", c)
+				continue
+			}
+			rule.Chats = append(rule.Chats, chatID)
+		}
+
+		if len(rule.Chats) == 0 {
+			slog.Warn("route has no chats, ignored", "route", name)
+			continue
+		}
+		cfg.RouteRules = append(cfg.RouteRules, rule)
+	}
+
 	return cfg
 }
 
@@ -159,3 +446,41 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// loadFilter 按前缀读取一组过滤规则
+func loadFilter(prefix string) ContentFilter {
+	f := ContentFilter{
+		IncludeTags:  splitList(getEnv(prefix+"INCLUDE_TAGS", "")),
+		ExcludeTags:  splitList(getEnv(prefix+"EXCLUDE_TAGS", "")),
+		BlockArtists: splitList(getEnv(prefix+"BLOCK_ARTISTS", "")),
+	}
+	f.MinWidth, _ = strconv.Atoi(getEnv(prefix+"MIN_WIDTH", "0"))
+	f.MinHeight, _ = strconv.Atoi(getEnv(prefix+"MIN_HEIGHT", "0"))
+	f.MinRatio, _ = strconv.ParseFloat(getEnv(prefix+"MIN_RATIO", "0"), 64)
+	f.MaxRatio, _ = strconv.ParseFloat(getEnv(prefix+"MAX_RATIO", "0"), 64)
+	return f
+}
+
+// DryRunFor 这个爬虫是否只演练，不发 Telegram 也不写 D1
+func (c *Config) DryRunFor(name string) bool {
+	for _, v := range c.DryRun {
+		if v == "all" || strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList 按逗号或换行切分配置项，并去掉空白项
+func splitList(value string) []string {
+	var items []string
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for _, p := range parts {
+		if strings.TrimSpace(p) != "" {
+			items = append(items, strings.TrimSpace(p))
+		}
+	}
+	return items
+}
@@ -9,9 +9,11 @@ import (
 	_ "image/jpeg" // 支持 JPG
 	_ "image/png"// 支持 PNG
 	_ "golang.org/x/image/webp"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
 	"strings"
 	"time"
@@ -24,13 +26,14 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 	client := resty.New()
 	client.SetTimeout(60 * time.Second)
 	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0")
+	logger := logging.Source("manyacg_sese")
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🎲 Starting Batch Sese (10 Pics)...")
+			logger.Info("cycle start", "batch", 10)
 
 			//  内部循环：一次爬 10 张
 			for i := 0; i < 10; i++ {
@@ -38,13 +41,13 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 
 				resp, err := client.R().Get(url)
 				if err != nil {
-					log.Printf("❌ ManyACG Sese Request Failed: %v", err)
+					logger.Warn("request failed", "err", err)
 					time.Sleep(2 * time.Second)
 					continue
 				}
 
 				if resp.StatusCode() != 200 {
-					log.Printf("❌ ManyACG Sese HTTP Error: %d", resp.StatusCode())
+					logger.Warn("request failed", "status", resp.StatusCode())
 					time.Sleep(2 * time.Second)
 					continue
 				}
@@ -60,10 +63,23 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 					idPart = idPart[:idx]
 				}
 
+				// 随机接口没有元数据，只能按固定标签过滤
+				meta := filter.Meta{Source: "manyacg_sese", ID: idPart, Tags: []string{"R18", "Sese", "ManyACG"}}
+				if !botHandler.Filter.Allow(meta) {
+					continue
+				}
+				if botHandler.DryRunSkip(ctx, meta) {
+					continue
+				}
+
 				originURL := fmt.Sprintf("https://api.manyacg.top/v1/picture/file/%s", idPart)
 				originResp, err := client.R().Get(originURL)
-				if err != nil || originResp.StatusCode() != 200 {
-					log.Printf("❌ Sese Origin Download Failed: %v (status=%d)", err, originResp.StatusCode())
+				if err != nil {
+					logger.Warn("download failed", "pic_id", idPart, "err", err)
+					continue
+				}
+				if originResp.StatusCode() != 200 {
+					logger.Warn("download failed", "pic_id", idPart, "status", originResp.StatusCode())
 					continue
 				}
 
@@ -75,7 +91,7 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 				// 5. 解析宽高
 				imgConfig, format, err := image.DecodeConfig(bytes.NewReader(imgData))
 				if err != nil {
-					 log.Printf("⚠️ Sese Decode Failed: %v", err)
+					 logger.Warn("decode failed", "pic_id", idPart, "err", err)
 					continue
 				}
 				width := imgConfig.Width
@@ -90,16 +106,20 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 					continue
 				}
 
-				// 8. 构造数据
-				title := "MtcACG: SESE"
-				tagsStr := "#R18 #Sese #ManyACG"
-				caption := fmt.Sprintf("%s\nFormat: %s (%dx%d)\nTags: %s",
-					title, strings.ToUpper(format), width, height, tagsStr)
-
-				log.Printf("⬇️ Got Sese [%d/10]: %s (%dx%d)", i+1, fileName, width, height)
+				logger.Info("downloaded", "post_id", pid, "batch_index", i+1, "width", width, "height", height)
 
 				// 9. 发送并保存（用原图数据）
-				botHandler.ProcessAndSend(ctx, imgData, pid, tagsStr, caption, "Manyacg_sese", "manyacg_sese", width, height)
+				botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+					PostID:  pid,
+					Source:  "manyacg_sese",
+					Title:   "SESE",
+					Note:    fmt.Sprintf("Format: %s (%dx%d)", strings.ToUpper(format), width, height),
+					Artist:  "Manyacg_sese",
+					Rating:  rating.Explicit,
+					Tags:    database.NewTags(database.TagGeneral, "R18", "Sese", "ManyACG"),
+					Width:   width,
+					Height:  height,
+				})
 				db.PushHistory()
 
 				// 每张图之间间隔 3 秒，防止 Telegram 发太快限流
@@ -108,8 +128,10 @@ func StartManyACGSese(ctx context.Context, cfg *config.Config, db *database.D1Cl
 
 
 			//  批次结束后，休息 10 分钟
-			log.Println("😴 Sese Batch Done. Sleeping 30m...")
-			time.Sleep(30 * time.Minute)
+			logger.Info("cycle done", "sleep", 30*time.Minute)
+			if !cycleDone(ctx, "sese", 30*time.Minute) {
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,474 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/danbooru"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/telegram"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// BooruPost 各方言解析后统一的帖子结构
+type BooruPost struct {
+	ID        int
+	ParentID  int
+	Tags      string
+	Artist    string
+	Rating    string
+	FileURL   string
+	SampleURL string
+	FileSize  int
+	Width     int
+	Height    int
+	FileExt   string
+	TagList   []database.Tag // 带分类的标签 (danbooru)，为空时把 Tags 都当作普通标签
+}
+
+// booruDialect 一种 booru API 格式
+type booruDialect interface {
+	// listURL 拼出按标签查询的地址，page 从 0 开始
+	listURL(site config.BooruSite, tags string, page int) string
+	parse(site config.BooruSite, body []byte) ([]BooruPost, error)
+	// linkRe 匹配 host 上的帖子页面链接，第一个分组是帖子 ID
+	linkRe(host string) *regexp.Regexp
+	// postURL 帖子页面地址，入库时作为来源链接
+	postURL(site config.BooruSite, id int) string
+}
+
+var booruDialects = map[string]booruDialect{
+	"moebooru": moebooruDialect{},
+	"danbooru": danbooruDialect{},
+	"gelbooru": gelbooruDialect{},
+}
+
+// ---------- moebooru (yande.re / konachan) ----------
+
+type moebooruDialect struct{}
+
+func (moebooruDialect) listURL(site config.BooruSite, tags string, page int) string {
+	return fmt.Sprintf("%s/post.json?limit=%d&page=%d&tags=%s", site.BaseURL, site.Limit, page+1, url.QueryEscape(tags))
+}
+
+func (moebooruDialect) parse(site config.BooruSite, body []byte) ([]BooruPost, error) {
+	var raw []struct {
+		ID        int    `json:"id"`
+		ParentID  int    `json:"parent_id"`
+		Tags      string `json:"tags"`
+		Rating    string `json:"rating"`
+		FileURL   string `json:"file_url"`
+		SampleURL string `json:"sample_url"`
+		JpegURL   string `json:"jpeg_url"`
+		FileSize  int    `json:"file_size"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		FileExt   string `json:"file_ext"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	var posts []BooruPost
+	for _, p := range raw {
+		sample := p.JpegURL
+		if sample == "" {
+			sample = p.SampleURL
+		}
+		posts = append(posts, BooruPost{
+			ID: p.ID, ParentID: p.ParentID, Tags: p.Tags, Rating: p.Rating,
+			FileURL: p.FileURL, SampleURL: sample, FileSize: p.FileSize,
+			Width: p.Width, Height: p.Height, FileExt: p.FileExt,
+		})
+	}
+	return posts, nil
+}
+
+func (moebooruDialect) linkRe(host string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(host) + `/post/show/(\d+)`)
+}
+
+func (moebooruDialect) postURL(site config.BooruSite, id int) string {
+	return fmt.Sprintf("%s/post/show/%d", site.BaseURL, id)
+}
+
+// ---------- danbooru ----------
+
+type danbooruDialect struct{}
+
+func (danbooruDialect) listURL(site config.BooruSite, tags string, page int) string {
+	return fmt.Sprintf("%s/posts.json?limit=%d&page=%d&tags=%s", site.BaseURL, site.Limit, page+1, url.QueryEscape(tags))
+}
+
+func (danbooruDialect) parse(site config.BooruSite, body []byte) ([]BooruPost, error) {
+	var raw []danbooru.Post
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	var posts []BooruPost
+	for _, p := range raw {
+		posts = append(posts, BooruPost{
+			ID: p.ID, ParentID: p.ParentID, Tags: p.TagString, Artist: p.Artist(), Rating: p.Rating,
+			FileURL: p.FileURL, SampleURL: p.LargeFileURL, FileSize: p.FileSize,
+			Width: p.ImageWidth, Height: p.ImageHeight, FileExt: p.FileExt, TagList: p.TagList(),
+		})
+	}
+	return posts, nil
+}
+
+// beforeURL 取 ID 小于 beforeID 的一页 (page=b<id>)，beforeID 为 0 时取最新一页
+func (danbooruDialect) beforeURL(site config.BooruSite, tags string, beforeID int) string {
+	u := fmt.Sprintf("%s/posts.json?limit=%d&tags=%s", site.BaseURL, site.Limit, url.QueryEscape(tags))
+	if beforeID > 0 {
+		u += fmt.Sprintf("&page=b%d", beforeID)
+	}
+	return u
+}
+
+func (danbooruDialect) linkRe(host string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(host) + `/posts/(\d+)`)
+}
+
+func (danbooruDialect) postURL(site config.BooruSite, id int) string {
+	return fmt.Sprintf("%s/posts/%d", site.BaseURL, id)
+}
+
+// ---------- gelbooru (gelbooru / safebooru) ----------
+
+type gelbooruDialect struct{}
+
+func (gelbooruDialect) listURL(site config.BooruSite, tags string, page int) string {
+	u := fmt.Sprintf("%s/index.php?page=dapi&s=post&q=index&json=1&limit=%d&pid=%d&tags=%s",
+		site.BaseURL, site.Limit, page, url.QueryEscape(tags))
+	if site.Username != "" && site.APIKey != "" {
+		u += "&user_id=" + url.QueryEscape(site.Username) + "&api_key=" + url.QueryEscape(site.APIKey)
+	}
+	return u
+}
+
+func (gelbooruDialect) parse(site config.BooruSite, body []byte) ([]BooruPost, error) {
+	type gelPost struct {
+		ID        int    `json:"id"`
+		ParentID  int    `json:"parent_id"`
+		Tags      string `json:"tags"`
+		Rating    string `json:"rating"`
+		FileURL   string `json:"file_url"`
+		SampleURL string `json:"sample_url"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Directory string `json:"directory"`
+		Image     string `json:"image"`
+	}
+
+	// 没有结果时返回空串
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil, nil
+	}
+
+	// gelbooru 外面包了一层 {"post": [...]}，safebooru 直接是数组
+	var raw []gelPost
+	if err := json.Unmarshal(body, &raw); err != nil {
+		var wrapped struct {
+			Post []gelPost `json:"post"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, err
+		}
+		raw = wrapped.Post
+	}
+
+	var posts []BooruPost
+	for _, p := range raw {
+		fileURL := p.FileURL
+		if fileURL == "" && p.Image != "" {
+			// safebooru 不返回 file_url，用 directory + image 拼出原图地址
+			fileURL = fmt.Sprintf("%s/images/%s/%s", site.BaseURL, p.Directory, p.Image)
+		}
+		posts = append(posts, BooruPost{
+			ID: p.ID, ParentID: p.ParentID, Tags: strings.TrimSpace(p.Tags), Rating: p.Rating,
+			FileURL: fileURL, SampleURL: p.SampleURL,
+			Width: p.Width, Height: p.Height, FileExt: strings.TrimPrefix(path.Ext(fileURL), "."),
+		})
+	}
+	return posts, nil
+}
+
+func (gelbooruDialect) linkRe(host string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(host) + `/index\.php\?page=post&s=view&id=(\d+)`)
+}
+
+func (gelbooruDialect) postURL(site config.BooruSite, id int) string {
+	return fmt.Sprintf("%s/index.php?page=post&s=view&id=%d", site.BaseURL, id)
+}
+
+// ---------- 通用逻辑 ----------
+
+// yande.re 和 danbooru 用各自的配置项 (YANDE_* / DANBOORU_*) 和专门的巡逻逻辑 (StartYande / StartDanbooru)
+// 请求、解析、下载、入库和链接处理都和 BOORU_SITES 里的站点共用
+
+func yandeSite(cfg *config.Config) config.BooruSite {
+	return config.BooruSite{
+		Name:    "yande",
+		Dialect: "moebooru",
+		BaseURL: "https://yande.re",
+		Tags:    cfg.YandeTags,
+		Limit:   cfg.YandeLimit,
+	}
+}
+
+func danbooruSite(cfg *config.Config) config.BooruSite {
+	return config.BooruSite{
+		Name:     "danbooru",
+		Dialect:  "danbooru",
+		BaseURL:  "https://danbooru.donmai.us",
+		Tags:     cfg.DanbooruTags,
+		Limit:    cfg.DanbooruLimit,
+		Username: cfg.DanbooruUsername,
+		APIKey:   cfg.DanbooruAPIKey,
+	}
+}
+
+func (p *BooruPost) isImage() bool {
+	if p.FileURL == "" && p.SampleURL == "" {
+		return false
+	}
+	switch strings.ToLower(p.FileExt) {
+	case "mp4", "webm", "zip", "swf":
+		return false
+	}
+	return true
+}
+
+func (p *BooruPost) bestURL() string {
+	const MaxSize = 13 * 1024 * 1024
+	if p.FileSize > 0 && p.FileSize >= MaxSize && p.SampleURL != "" {
+		return p.SampleURL
+	}
+	if p.FileURL == "" {
+		return p.SampleURL
+	}
+	return p.FileURL
+}
+
+func newBooruClient(site config.BooruSite) *resty.Client {
+	client := resty.New()
+	client.SetTimeout(60 * time.Second)
+	client.SetRetryCount(2)
+	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	client.SetHeader("Referer", site.BaseURL+"/")
+	if site.Dialect == "danbooru" && site.Username != "" && site.APIKey != "" {
+		client.SetBasicAuth(site.Username, site.APIKey)
+	}
+	return client
+}
+
+func fetchBooruPosts(client *resty.Client, site config.BooruSite, tags string, page int) ([]BooruPost, error) {
+	return getBooruPosts(client, site, booruDialects[site.Dialect].listURL(site, tags, page))
+}
+
+func getBooruPosts(client *resty.Client, site config.BooruSite, listURL string) ([]BooruPost, error) {
+	resp, err := client.R().Get(listURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("API status %d", resp.StatusCode())
+	}
+	return booruDialects[site.Dialect].parse(site, resp.Body())
+}
+
+func downloadBooruPost(client *resty.Client, post BooruPost) ([]byte, error) {
+	imgResp, err := client.R().Get(post.bestURL())
+	if err != nil {
+		return nil, err
+	}
+	if imgResp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d", imgResp.StatusCode())
+	}
+	return imgResp.Body(), nil
+}
+
+// booruMeta 构造入库用的元数据，pid 为单图 ID
+func booruMeta(site config.BooruSite, post BooruPost, pid string) database.ImageMeta {
+	artist := post.Artist
+	if artist == "" {
+		artist = site.Name + " artist"
+	}
+	tags := post.TagList
+	if len(tags) == 0 {
+		tags = database.SplitTags(database.TagGeneral, post.Tags)
+	}
+	return database.ImageMeta{
+		PostID:    pid,
+		Source:    site.Name,
+		SourceURL: booruDialects[site.Dialect].postURL(site, post.ID),
+		ArtistID:  post.Artist,
+		Artist:    artist,
+		Rating:    rating.FromBooru(post.Rating),
+		Tags:      tags,
+		Width:     post.Width,
+		Height:    post.Height,
+	}
+}
+
+func (p BooruPost) filterMeta(source string) filter.Meta {
+	return filter.Meta{
+		Source: source,
+		ID:     fmt.Sprint(p.ID),
+		Tags:   strings.Fields(p.Tags),
+		Artist: p.Artist,
+		Width:  p.Width,
+		Height: p.Height,
+	}
+}
+
+// sendBooruPost 下载并发送单张图，返回是否真正发送
+func sendBooruPost(ctx context.Context, client *resty.Client, site config.BooruSite, post BooruPost, db *database.D1Client, botHandler *telegram.BotHandler) bool {
+	if !post.isImage() {
+		return false
+	}
+
+	pid := fmt.Sprintf("%s_%d", site.Name, post.ID)
+	if db.CheckExists(pid) {
+		return false
+	}
+
+	logger := logging.Post(site.Name, pid)
+	logger.Info("downloading")
+	imgData, err := downloadBooruPost(client, post)
+	if err != nil {
+		logger.Warn("download failed", "err", err)
+		return false
+	}
+
+	botHandler.ProcessAndSend(ctx, imgData, booruMeta(site, post, pid))
+	return true
+}
+
+// StartBooru 按配置巡逻所有通用 booru 站点
+func StartBooru(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	var sites []config.BooruSite
+	for _, site := range cfg.BooruSites {
+		if _, ok := booruDialects[site.Dialect]; !ok {
+			slog.Warn("booru site has unknown dialect, ignored", "source", site.Name, "dialect", site.Dialect)
+			continue
+		}
+		if site.Tags == "" || site.Limit <= 0 {
+			continue
+		}
+		sites = append(sites, site)
+	}
+	if len(sites) == 0 {
+		slog.Info("booru disabled, no sites with tags configured")
+		return
+	}
+
+	clients := make(map[string]*resty.Client)
+	for _, site := range sites {
+		clients[site.Name] = newBooruClient(site)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			for _, site := range sites {
+				logger := logging.Source(site.Name)
+				logger.Info("checking tags", "tags", site.Tags)
+
+				client := clients[site.Name]
+				posts, err := fetchBooruPosts(client, site, site.Tags, 0)
+				if err != nil {
+					logger.Warn("api request failed", "err", err)
+					continue
+				}
+
+				for _, post := range posts {
+					// 巡逻时才过滤，用户手动发的链接照发
+					if !botHandler.Filter.Allow(post.filterMeta(site.Name)) {
+						continue
+					}
+					if botHandler.DryRunSkip(ctx, post.filterMeta(site.Name)) {
+						continue
+					}
+					if sendBooruPost(ctx, client, site, post, db, botHandler) {
+						db.PushHistory()
+						time.Sleep(10 * time.Second)
+					}
+				}
+				time.Sleep(20 * time.Second)
+			}
+
+			slog.Info("booru cycle done", "sleep", 53*time.Minute)
+			if !cycleDone(ctx, "booru", 53*time.Minute) {
+				return
+			}
+		}
+	}
+}
+
+// RegisterBooruLinks 给 yande.re、danbooru 和每个配置的 booru 站点自动注册链接处理
+// 同一个域名只注册一次，BOORU_SITES 里再配 yande.re 或 danbooru 不会重复
+func RegisterBooruLinks(cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	registered := make(map[string]bool)
+	for _, site := range append([]config.BooruSite{yandeSite(cfg), danbooruSite(cfg)}, cfg.BooruSites...) {
+		dialect, ok := booruDialects[site.Dialect]
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(site.BaseURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := strings.TrimPrefix(u.Host, "www.")
+		if registered[host] {
+			continue
+		}
+		registered[host] = true
+
+		site := site
+		site.Limit = 1 // 链接只按 ID 查一张
+		client := newBooruClient(site)
+		re := dialect.linkRe(host)
+
+		botHandler.RegisterLink(re, site.Name, func(ctx context.Context, text string) (int, int, error) {
+			matches := re.FindStringSubmatch(text)
+			if len(matches) < 2 {
+				return 0, 0, fmt.Errorf("invalid %s url", site.Name)
+			}
+			id, _ := strconv.Atoi(matches[1])
+
+			if db.CheckExists(fmt.Sprintf("%s_%d", site.Name, id)) {
+				return 0, 1, nil
+			}
+
+			posts, err := fetchBooruPosts(client, site, fmt.Sprintf("id:%d", id), 0)
+			if err != nil {
+				return 0, 0, err
+			}
+			if len(posts) == 0 {
+				return 0, 0, fmt.Errorf("post not found: %d", id)
+			}
+			if !sendBooruPost(ctx, client, site, posts[0], db, botHandler) {
+				return 0, 0, fmt.Errorf("unsupported or failed download: %d", id)
+			}
+			return 1, 0, nil
+		})
+		slog.Info("booru link handler registered", "source", site.Name, "host", host)
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
 
 	"github.com/go-resty/resty/v2"
@@ -31,8 +33,9 @@ type CosineImage struct {
 }
 
 func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("cosine")
 	if len(cfg.CosineTags) == 0 {
-		log.Printf("⚠️ No CosineTags configured. Skipping Cosine Crawler.")
+		logger.Info("disabled, no tags configured")
 		return
 	}
 
@@ -49,9 +52,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 		"Referer":    "https://www.pixiv.net/",
 	}
 
-	log.Println("🚀 Starting Cosine Tag Crawler...")
-	log.Printf("🎯 Target Tags: %v", cfg.CosineTags)
-	log.Printf("📊 Limit Per Tag: %d", cfg.CosineLimitPerTag)
+	logger.Info("starting", "tags", cfg.CosineTags, "limit_per_tag", cfg.CosineLimitPerTag)
 
 	for {
 		select {
@@ -59,7 +60,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 			return
 		default:
 			for _, tag := range cfg.CosineTags {
-				log.Printf("🏷️  Scanning Tag: %s", tag)
+				logger.Info("checking tag", "tag", tag)
 				
 				processedCount := 0
 				start := 0
@@ -75,23 +76,27 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 							"limit": fmt.Sprintf("%d", limit),
 						}).Get(apiURL)
 
-					if err != nil || resp.StatusCode() != 200 {
-						log.Printf("❌ API Request Failed for tag %s: %v", tag, err)
+					if err != nil {
+						logger.Warn("api request failed", "tag", tag, "err", err)
+						break
+					}
+					if resp.StatusCode() != 200 {
+						logger.Warn("api request failed", "tag", tag, "status", resp.StatusCode())
 						break
 					}
 
 					var images []CosineImage
 					if err := json.Unmarshal(resp.Body(), &images); err != nil {
-						log.Printf("❌ JSON Unmarshal Failed: %v", err)
+						logger.Warn("api response decode failed", "tag", tag, "err", err)
 						break
 					}
 
 					if len(images) == 0 {
-						log.Println("🏁 No more images for this tag.")
+						logger.Info("no more images", "tag", tag)
 						break
 					}
 
-					log.Printf("📄 Fetched %d images (start=%d)", len(images), start)
+					logger.Debug("fetched images", "tag", tag, "count", len(images), "start", start)
 
 					for _, img := range images {
 						if processedCount >= cfg.CosineLimitPerTag {
@@ -121,9 +126,17 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
                            db.CheckExists(dbKey+".jpg") || 
                            db.CheckExists(dbKey+".png") || 
                            db.CheckExists(dbKey+".webp") {
-                             log.Printf("♻️ cosine-Skip %s (Already in DB)", dbKey)
+                             logger.Debug("skip, already in db", "post_id", dbKey)
                             continue
                         }
+
+						meta := filter.Meta{Source: "cosine", ID: dbKey, Tags: img.Tags, Artist: img.Author, Width: img.Width, Height: img.Height}
+						if !botHandler.Filter.Allow(meta) {
+							continue
+						}
+						if botHandler.DryRunSkip(ctx, meta) {
+							continue
+						}
 						
 						var imgData []byte
 						var finalExt string = ".jpg"
@@ -139,7 +152,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 							finalExt = "." + img.Extension
 						}
 
-						log.Printf("⬇️  Downloading: %s (%s)", img.Title, dbKey)
+						logger.Info("downloading", "post_id", dbKey, "title", img.Title)
 
 						dlHeaders := indexHeaders
 						if strings.Contains(downloadURL, "pximg.net") {
@@ -151,7 +164,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 
 						// 2. 备用方案
 						if !success {
-							log.Printf("⚠️ Primary Source Failed, trying Cosine Backup...")
+							logger.Warn("primary source failed, trying backup", "post_id", dbKey)
 							
 							platformDir := "pixiv"
 							if strings.Contains(img.RawURL, "twimg.com") || img.Platform == "twitter" {
@@ -162,7 +175,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 							
 							// 策略 A: 原始文件名
 							backupURL := backupBase + img.Filename
-							log.Printf("🔄 Trying Backup A: %s", backupURL)
+							logger.Debug("trying backup", "post_id", dbKey, "url", backupURL)
 							imgResp, err = client.R().SetHeaders(indexHeaders).Get(backupURL)
 
 							if err == nil && imgResp.StatusCode() == 200 {
@@ -174,7 +187,7 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 									nameNoExt = img.Filename[:idx]
 								}
 								backupURL = backupBase + nameNoExt + ".webp"
-								log.Printf("🔄 Trying Backup B: %s", backupURL)
+								logger.Debug("trying backup", "post_id", dbKey, "url", backupURL)
 								imgResp, err = client.R().SetHeaders(indexHeaders).Get(backupURL)
 								
 								if err == nil && imgResp.StatusCode() == 200 {
@@ -185,22 +198,34 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 						}
 
 						if !success {
-							log.Printf("❌ All sources failed for: %s, Skipping.", dbKey)
+							logger.Warn("all sources failed, skipping", "post_id", dbKey)
 							continue
 						}
 						
 						imgData = imgResp.Body()
 
 						cleanTitle := strings.TrimSpace(img.Title)
-						tagsStr := strings.Join(img.Tags, " #")
-						caption := fmt.Sprintf("Title: %s\nArtist: %s\nTags: #%s\nSource: %s",
-							cleanTitle, img.Author, tagsStr, "pic.cosine.ren")
 						
 						// 构造发给 TG 的文件名 (必须带后缀，骗过 TG)
 						sendID := dbKey + finalExt
 
 						// 发送
-						botHandler.ProcessAndSend(ctx, imgData, sendID, strings.Join(img.Tags, " "), caption, img.Author, "pixiv", img.Width, img.Height)
+						// sendID 带后缀，作品 ID 和页码按标准 Key 算
+						keyMeta := database.ImageMeta{PostID: dbKey}
+						artworkID, pageIndex := keyMeta.Artwork()
+						botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+							PostID:    sendID,
+							ArtworkID: artworkID,
+							PageIndex: pageIndex,
+							Source:    "pixiv",
+							SourceURL: "https://www.pixiv.net/artworks/" + pidStr,
+							Title:     cleanTitle,
+							Artist:    img.Author,
+							Rating:    rating.FromTags(img.Tags, rating.Safe),
+							Tags:      database.NewTags(database.TagGeneral, img.Tags...),
+							Width:     img.Width,
+							Height:    img.Height,
+						})
                         
                         // 存库 (存标准 Key，无后缀)
                         // 注意：显式调用 PushHistory，防止 ProcessAndSend 没存对
@@ -216,8 +241,10 @@ func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Clie
 				}
 			}
 
-			log.Println("😴 Cosine Crawler Cycle Done. Sleeping 127 Mins...")
-			time.Sleep(127 * time.Minute)
+			logger.Info("cycle done", "sleep", 127*time.Minute)
+			if !cycleDone(ctx, "cosine", 127*time.Minute) {
+				return
+			}
 		}
 	}
 }
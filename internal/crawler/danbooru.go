@@ -2,144 +2,129 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/logging"
 	"my-bot-go/internal/telegram"
-	"net/url" // ✅ 必须加这个包
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/go-resty/resty/v2"
 )
 
-// DanbooruPost 对应 /posts.json 返回的字段
-type DanbooruPost struct {
-	ID           int    `json:"id"`
-	ImageWidth   int    `json:"image_width"`
-	ImageHeight  int    `json:"image_height"`
-	TagString    string `json:"tag_string"`
-	FileURL      string `json:"file_url"`
-	LargeFileURL string `json:"large_file_url"`
-	FileExt      string `json:"file_ext"` // jpg, png, mp4, webm...
-}
+// crawler_state 里保存 Danbooru 上次看到的最大 ID，后面跟上标签，换了标签不会沿用旧的进度
+const danbooruStateKey = "danbooru_last_seen_id:"
 
 // StartDanbooru 自动按标签巡逻 Danbooru
+// 请求和下载走 booru 适配器的 danbooru 方言，这里只负责按 ID 往前翻页
 func StartDanbooru(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("danbooru")
 	if cfg.DanbooruTags == "" || cfg.DanbooruLimit <= 0 {
-		log.Println("Danbooru disabled (no tags or limit).")
+		logger.Info("disabled, no tags or limit")
 		return
 	}
 
-	client := resty.New().
-		SetTimeout(60 * time.Second). // 超时设长一点
-		SetRetryCount(2)
+	site := danbooruSite(cfg)
+	client := newBooruClient(site)
 
 	// ✅ 使用 Config 中的配置进行认证
-	if cfg.DanbooruUsername != "" && cfg.DanbooruAPIKey != "" {
-		client.SetBasicAuth(cfg.DanbooruUsername, cfg.DanbooruAPIKey)
-		log.Println("🔑 Danbooru API Key enabled")
+	if site.Username != "" && site.APIKey != "" {
+		logger.Info("api key enabled")
+	} else {
+		logger.Warn("api key missing, cloudflare might block requests")
+	}
+
+	// page=b<id> 只对按 ID 排序的结果有意义，带 order: 的查询只看第一页，也不记进度
+	idPaging := !strings.Contains(cfg.DanbooruTags, "order:")
+	if !idPaging {
+		logger.Info("tags contain order:, pagination disabled, DANBOORU_MAX_PAGES ignored")
+	}
+
+	// 上一轮看到的最大 ID，翻页翻到它就停，存在 D1 里，重启后接着翻
+	stateKey := danbooruStateKey + site.Tags
+	lastSeenID := 0
+	if v, err := db.GetState(stateKey); err != nil {
+		logger.Warn("load last seen id failed", "err", err)
 	} else {
-		log.Println("⚠️ Danbooru API Key missing (Cloudflare might block requests)")
+		lastSeenID, _ = strconv.Atoi(v)
 	}
-	
-	// 设置 User-Agent 和 Accept 头
-	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	client.SetHeader("Accept", "application/json")
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🔍 Checking Danbooru...")
-
-			// ✅ 关键修正：对 Tags 进行 URL 编码，防止空格导致 URL 断裂
-			encodedTags := url.QueryEscape(cfg.DanbooruTags)
-
-			// 构造查询 URL
-			targetURL := fmt.Sprintf(
-				"https://danbooru.donmai.us/posts.json?limit=%d&tags=%s",
-				cfg.DanbooruLimit,
-				encodedTags,
-			)
-
-			resp, err := client.R().Get(targetURL)
-			if err != nil {
-				log.Printf("Danbooru Error: %v", err)
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			// 如果遇到非 200 状态码 (比如 403 Forbidden)，打印 Body 方便调试
-			if resp.StatusCode() != 200 {
-				log.Printf("⚠️ Danbooru API Status: %d | Body: %s", resp.StatusCode(), string(resp.Body()))
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			var posts []DanbooruPost
-			if err := json.Unmarshal(resp.Body(), &posts); err != nil {
-				log.Printf("Danbooru JSON Error: %v", err)
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			for _, post := range posts {
-				// 跳过无图 / 视频 / zip 等
-				if post.FileURL == "" || post.LargeFileURL == "" {
-					continue
+			logger.Info("cycle start")
+
+			maxID := lastSeenID
+			beforeID := 0
+			// 翻到了上次看到的 ID (或冷启动的第一页) 才能前移进度，
+			// 中途请求失败或页数用完时中间还有没看过的帖子，下一轮从头再翻
+			caughtUp := false
+
+			for pageNum := 0; pageNum < cfg.DanbooruMaxPages; pageNum++ {
+				posts, err := getBooruPosts(client, site, danbooruDialect{}.beforeURL(site, site.Tags, beforeID))
+				if err != nil {
+					logger.Warn("api request failed", "err", err)
+					break
 				}
-				ext := strings.ToLower(post.FileExt)
-				if ext == "mp4" || ext == "webm" || ext == "zip" || ext == "swf" {
-					continue
+				if len(posts) == 0 {
+					caughtUp = true
+					break
 				}
 
-				pid := fmt.Sprintf("danbooru_%d", post.ID)
-				if db.History[pid] {
-					continue
+				reachedSeen := false
+				minID := 0
+				for _, post := range posts {
+					if minID == 0 || post.ID < minID {
+						minID = post.ID
+					}
+					if post.ID > maxID {
+						maxID = post.ID
+					}
+					if idPaging && lastSeenID > 0 && post.ID <= lastSeenID {
+						reachedSeen = true
+						continue
+					}
+
+					if !botHandler.Filter.Allow(post.filterMeta(site.Name)) {
+						continue
+					}
+					if botHandler.DryRunSkip(ctx, post.filterMeta(site.Name)) {
+						continue
+					}
+					if sendBooruPost(ctx, client, site, post, db, botHandler) {
+						// 每发完一张图，立刻同步到云端
+						db.PushHistory()
+						time.Sleep(3 * time.Second)
+					}
 				}
 
-				// 下载图片
-				imgURL := post.FileURL
-				log.Printf("⬇️ Downloading Danbooru: %d", post.ID)
-
-				imgResp, err := client.R().Get(imgURL)
-				if err != nil || imgResp.StatusCode() != 200 {
-					log.Printf("Danbooru download error: %v", err)
-					continue
+				if !idPaging {
+					break
 				}
-
-				tagsStr := post.TagString
-				caption := fmt.Sprintf(
-					"Danbooru: %d\nTags: #%s",
-					post.ID,
-					strings.ReplaceAll(tagsStr, " ", " #"),
-				)
-
-				// 发送
-				botHandler.ProcessAndSend(
-					ctx,
-					imgResp.Body(),
-					pid,
-					tagsStr,
-					caption,
-					"",
-					"danbooru",
-					post.ImageWidth,
-					post.ImageHeight,
-				)
-
-				// 每发完一张图，立刻同步到云端
-				db.PushHistory()
-
+				if reachedSeen || lastSeenID == 0 {
+					// 第一轮只看第一页，避免冷启动时把整个标签翻一遍
+					caughtUp = true
+					break
+				}
+				beforeID = minID
 				time.Sleep(3 * time.Second)
 			}
 
-			log.Println("😴 Danbooru Done. Sleeping 10m...")
-			time.Sleep(60 * time.Minute)
+			if idPaging && !caughtUp {
+				logger.Warn("last seen id not reached, keep cursor", "last_seen_id", lastSeenID, "max_pages", cfg.DanbooruMaxPages)
+			}
+			if idPaging && caughtUp && maxID > lastSeenID {
+				lastSeenID = maxID
+				if err := db.SetState(stateKey, strconv.Itoa(maxID)); err != nil {
+					logger.Warn("save last seen id failed", "err", err)
+				}
+			}
+
+			logger.Info("cycle done", "sleep", 60*time.Minute)
+			if !cycleDone(ctx, "danbooru", 60*time.Minute) {
+				return
+			}
 		}
 	}
 }
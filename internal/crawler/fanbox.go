@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/fanbox"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/telegram"
+)
+
+// StartFanbox 按 FANBOX_CREATOR_IDS 巡逻创作者的最新帖子，需要 FANBOX_COOKIE
+func StartFanbox(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("fanbox")
+	if cfg.FanboxCookie == "" || len(cfg.FanboxCreatorIDs) == 0 {
+		logger.Info("disabled, no cookie or creators configured")
+		return
+	}
+
+	// 档位不够的帖子每轮都会出现，只提示一次
+	lockedSeen := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			logger.Info("cycle start")
+
+			for _, creatorID := range cfg.FanboxCreatorIDs {
+				items, err := fanbox.ListCreatorPosts(creatorID, cfg.FanboxCookie)
+				if err != nil {
+					logger.Warn("list posts failed", "creator", creatorID, "err", err)
+					continue
+				}
+
+				count := 0
+				for _, item := range items {
+					if count >= cfg.FanboxLimit {
+						break
+					}
+
+					// 帖子处理完会记下 fanbox_<id>，没有图片的帖子也不会每轮重抓
+					pid := fmt.Sprintf("fanbox_%s", item.ID)
+					if db.CheckExists(pid) {
+						continue
+					}
+
+					if item.IsRestricted {
+						if !lockedSeen[item.ID] {
+							logger.Info("skip restricted post", "post_id", pid, "title", item.Title, "fee", item.FeeRequired)
+							lockedSeen[item.ID] = true
+						}
+						continue
+					}
+
+					if processFanboxPost(ctx, cfg, item.ID, db, botHandler) {
+						db.MarkHistory(pid)
+					}
+					db.PushHistory()
+					count++
+					time.Sleep(5 * time.Second)
+				}
+			}
+
+			logger.Info("cycle done", "sleep", 67*time.Minute)
+			if !cycleDone(ctx, "fanbox", 67*time.Minute) {
+				return
+			}
+		}
+	}
+}
+
+// processFanboxPost 发送帖子里的图片，每一页都发出去或者之前发过时返回 true
+func processFanboxPost(ctx context.Context, cfg *config.Config, postID string, db *database.D1Client, botHandler *telegram.BotHandler) bool {
+	logger := logging.Post("fanbox", "fanbox_"+postID)
+	post, err := fanbox.GetFanboxPost(postID, cfg.FanboxCookie)
+	if errors.Is(err, fanbox.ErrRestricted) {
+		logger.Info("skip restricted post", "fee", post.FeeRequired)
+		return false
+	}
+	if err != nil {
+		logger.Warn("get post failed", "err", err)
+		return false
+	}
+
+	done := true
+	for i, img := range post.Images {
+		pid := fmt.Sprintf("fanbox_%s_p%d", post.ID, i)
+		if db.CheckExists(pid) {
+			continue
+		}
+
+		meta := filter.Meta{Source: "fanbox", ID: pid, Tags: post.Tags, Artist: post.Author, Width: img.Width, Height: img.Height}
+		if !botHandler.Filter.Allow(meta) {
+			continue
+		}
+		if botHandler.DryRunSkip(ctx, meta) {
+			continue
+		}
+
+		logger.Info("downloading", "page", i)
+		imgData, err := fanbox.DownloadFanboxImage(img.URL, cfg.FanboxCookie)
+		if err != nil {
+			logger.Warn("download failed", "page", i, "err", err)
+			done = false
+			continue
+		}
+		width, height := fanbox.DecodeSize(img, imgData)
+
+		sent := botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "fanbox",
+			SourceURL: fmt.Sprintf("https://%s.fanbox.cc/posts/%s", post.CreatorID, post.ID),
+			PageCount: len(post.Images),
+			Title:     post.Title,
+			ArtistID:  post.CreatorID,
+			Artist:    post.Author,
+			Rating:    rating.FromFlag(post.Adult),
+			Tags:      database.NewTags(database.TagGeneral, post.Tags...),
+			Width:     width,
+			Height:    height,
+		})
+		if !sent {
+			done = false
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return done
+}
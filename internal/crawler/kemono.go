@@ -4,33 +4,40 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
 	"path"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+type kemonoFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
 type KemonoPostResp struct {
 	Post struct {
-		ID          string   `json:"id"`
-		User        string   `json:"user"`
-		Service     string   `json:"service"`
-		Title       string   `json:"title"`
-		Content     string   `json:"content"`
-		Tags        []string `json:"tags"`
-		Attachments []struct {
-			Path string `json:"path"`
-			Name string `json:"name"`
-		} `json:"attachments"`
+		ID          string       `json:"id"`
+		User        string       `json:"user"`
+		Service     string       `json:"service"`
+		Title       string       `json:"title"`
+		Content     string       `json:"content"`
+		Tags        []string     `json:"tags"`
+		File        kemonoFile   `json:"file"`
+		Attachments []kemonoFile `json:"attachments"`
 	} `json:"post"`
 	Previews []struct {
 		Type   string `json:"type"`   // "thumbnail"
@@ -39,23 +46,67 @@ type KemonoPostResp struct {
 	} `json:"previews"`
 }
 
+// Coomer 与 Kemono 是同一套程序，这几个平台挂在 coomer 域名下
+var coomerServices = map[string]bool{
+	"onlyfans": true,
+	"fansly":   true,
+	"candfans": true,
+}
+
+// 一页固定 50 条，用 ?o= 偏移翻页
+const kemonoPageSize = 50
+
+var kemonoImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".gif": true}
+
+// errKemonoFiltered 帖子被内容过滤拦下，不算失败
+var errKemonoFiltered = errors.New("filtered")
+
+var kemonoContentImgRe = regexp.MustCompile(`<img[^>]+src="([^"]+)"`)
+
+// Coomer 上全是成人内容，Kemono 按配置的默认分级
+func kemonoDefaultRating(service string, cfg *config.Config) string {
+	if coomerServices[service] {
+		return rating.Explicit
+	}
+	return cfg.KemonoRating
+}
+
+func kemonoBaseURL(service string) string {
+	if coomerServices[service] {
+		return "https://coomer.st"
+	}
+	return "https://kemono.cr"
+}
+
 func StartKemono(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("kemono")
 	if len(cfg.KemonoCreators) == 0 {
-		log.Println("Kemono disabled (no creators configured)")
+		logger.Info("disabled, no creators configured")
 		return
 	}
 
+	// 重试统一交给 resty，节点偶尔 5xx 或超时
 	client := resty.New().
 		SetTimeout(60 * time.Second).
-		SetRetryCount(3)
+		SetRetryCount(3).
+		SetRetryWaitTime(5 * time.Second).
+		SetRetryMaxWaitTime(15 * time.Second).
+		AddRetryCondition(func(r *resty.Response, err error) bool {
+			// 自定义条件会替换掉默认的出错重试，超时和连接断开要自己算上
+			return err != nil || r.StatusCode() == 429 || r.StatusCode() >= 500
+		})
+	// Kemono 的 API 不带这个头会被 DDoS-Guard 拦下
+	client.SetHeader("Accept", "text/css")
+
+	// 回溯模式只需要跑完一遍完整历史
+	backfill := cfg.KemonoBackfill
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🧩 Checking Kemono...")
-			// 移除 hasNew 变量，改为即时保存
+			logger.Info("cycle start")
 
 			for _, creator := range cfg.KemonoCreators {
 				service := strings.TrimSpace(creator.Service)
@@ -64,74 +115,121 @@ func StartKemono(ctx context.Context, cfg *config.Config, db *database.D1Client,
 					if uid == "" {
 						continue
 					}
+					crawlKemonoCreator(ctx, cfg, client, service, uid, backfill, db, botHandler)
+				}
+			}
 
-					listURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/posts", service, uid)
-					resp, err := client.R().Get(listURL)
-					if err != nil {
-						log.Printf("⚠️ Kemono list error (%s/%s): %v", service, uid, err)
-						continue
-					}
+			if backfill {
+				logger.Info("backfill finished, switching to latest-only mode")
+				backfill = false
+			}
 
-					var posts []struct {
-						ID string `json:"id"`
-					}
-					if err := json.Unmarshal(resp.Body(), &posts); err != nil {
-						log.Printf("⚠️ Kemono list JSON error: %v", err)
-						continue
-					}
+			// 循环结束后休息
+			logger.Info("cycle done", "sleep", 10*time.Minute)
+			if !cycleDone(ctx, "kemono", 10*time.Minute) {
+				return
+			}
+		}
+	}
+}
 
-					// 最新的在前面，一次只抓前 N 个防止刷屏
-					maxPosts := 5
-					for i, p := range posts {
-						if i >= maxPosts {
-							break
-						}
-						pid := fmt.Sprintf("kemono_%s_%s_%s", service, uid, p.ID)
-						// 粗略过滤，防止同一个 Post 反复进 fetchKemonoPost
-						if db.History[pid] {
-							continue
-						}
-						
-						// 进入详情抓取
-						err := fetchKemonoPost(ctx, client, service, uid, p.ID, pid, db, botHandler)
-						if err != nil {
-							log.Printf("❌ Failed to fetch post %s: %v", p.ID, err)
-						} else {
-							// 如果整个 Post 处理成功，把 Post ID 标记为已完成
-							db.History[pid] = true
-						}
-
-						// ✅ 【关键修改】每处理完一个 Post，立刻推送到 D1
-						db.PushHistory()
-						
-						time.Sleep(3 * time.Second)
-					}
-				}
+// crawlKemonoCreator 按偏移翻页抓取一个作者的帖子
+// 普通模式只看第一页的前 KemonoLimit 个，回溯模式一直翻到没有数据
+func crawlKemonoCreator(
+	ctx context.Context,
+	cfg *config.Config,
+	client *resty.Client,
+	service, uid string,
+	backfill bool,
+	db *database.D1Client,
+	botHandler *telegram.BotHandler,
+) {
+	base := kemonoBaseURL(service)
+	processed := 0
+	logger := logging.Source("kemono").With("service", service, "user", uid)
+
+	for offset := 0; ; offset += kemonoPageSize {
+		listURL := fmt.Sprintf("%s/api/v1/%s/user/%s/posts?o=%d", base, service, uid, offset)
+		resp, err := client.R().SetContext(ctx).Get(listURL)
+		if err != nil {
+			logger.Warn("list posts failed", "offset", offset, "err", err)
+			return
+		}
+		if resp.StatusCode() != 200 {
+			logger.Warn("list posts failed", "offset", offset, "status", resp.StatusCode())
+			return
+		}
+
+		var posts []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(resp.Body(), &posts); err != nil {
+			logger.Warn("list posts decode failed", "offset", offset, "err", err)
+			return
+		}
+		if len(posts) == 0 {
+			return
+		}
+
+		for _, p := range posts {
+			if !backfill && processed >= cfg.KemonoLimit {
+				return
 			}
 
-			// 循环结束后休息
-			log.Println("😴 Kemono Done. Sleeping 10m...")
-			time.Sleep(10 * time.Minute)
+			pid := fmt.Sprintf("kemono_%s_%s_%s", service, uid, p.ID)
+			// 粗略过滤，防止同一个 Post 反复进 fetchKemonoPost
+			if db.CheckExists(pid) {
+				continue
+			}
+
+			// 进入详情抓取
+			complete, err := fetchKemonoPost(ctx, client, base, service, uid, p.ID, pid, kemonoDefaultRating(service, cfg), db, botHandler)
+			if errors.Is(err, errKemonoFiltered) {
+				// 不记历史，调整过滤规则后还能补发
+			} else if err != nil {
+				logger.Warn("fetch post failed", "post_id", pid, "err", err)
+			} else if complete {
+				// 只有所有图片都成功，才把 Post ID 标记为已完成，否则下轮继续补
+				db.MarkHistory(pid)
+			} else {
+				logger.Warn("post partially failed, will retry next round", "post_id", pid)
+			}
+
+			// ✅ 每处理完一个 Post，立刻推送到 D1
+			db.PushHistory()
+			processed++
+
+			time.Sleep(3 * time.Second)
+		}
+
+		if !backfill || len(posts) < kemonoPageSize {
+			return
 		}
+		time.Sleep(5 * time.Second)
 	}
 }
 
+// fetchKemonoPost 抓取帖子里的所有图片：file 字段、attachments、正文里的 <img>
+// 返回值 complete 表示所有图片都已发送 (或早已发过)
 func fetchKemonoPost(
 	ctx context.Context,
 	client *resty.Client,
-	service, uid, postID, basePID string,
+	base, service, uid, postID, basePID, defaultRating string,
 	db *database.D1Client,
 	botHandler *telegram.BotHandler,
-) error {
-	apiURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/post/%s", service, uid, postID)
+) (bool, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/%s/user/%s/post/%s", base, service, uid, postID)
 	resp, err := client.R().SetContext(ctx).Get(apiURL)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if resp.StatusCode() != 200 {
+		return false, fmt.Errorf("post status %d", resp.StatusCode())
 	}
 
 	var kResp KemonoPostResp
 	if err := json.Unmarshal(resp.Body(), &kResp); err != nil {
-		return err
+		return false, err
 	}
 
 	// 构建 path -> server 映射
@@ -143,34 +241,93 @@ func fetchKemonoPost(
 		cdnMap[p.Path] = p.Server
 	}
 
-	// 下载每一张图
-	for idx, att := range kResp.Post.Attachments {
-		ext := strings.ToLower(path.Ext(att.Path))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
+	// 收集所有图片来源，按 file -> attachments -> 正文 的顺序，按 path 去重
+	var imageURLs []string
+	var skipped []string
+	seen := make(map[string]bool)
+
+	addFile := func(f kemonoFile) {
+		if f.Path == "" || seen[f.Path] {
+			return
+		}
+		seen[f.Path] = true
+
+		ext := strings.ToLower(path.Ext(f.Path))
+		if !kemonoImageExts[ext] {
+			// zip / psd / clip 等无法发成图片，记下来报告
+			name := f.Name
+			if name == "" {
+				name = path.Base(f.Path)
+			}
+			skipped = append(skipped, name)
+			return
+		}
+
+		// 没有缩略图信息时走主站 /data，由主站重定向到正确的节点
+		server := cdnMap[f.Path]
+		if server == "" {
+			server = base
+		}
+		imageURLs = append(imageURLs, server+"/data"+f.Path)
+	}
+
+	addFile(kResp.Post.File)
+	for _, att := range kResp.Post.Attachments {
+		addFile(att)
+	}
+	for _, m := range kemonoContentImgRe.FindAllStringSubmatch(kResp.Post.Content, -1) {
+		src := m[1]
+		if strings.HasPrefix(src, "http") {
+			if !seen[src] {
+				seen[src] = true
+				imageURLs = append(imageURLs, src)
+			}
 			continue
 		}
+		addFile(kemonoFile{Path: strings.TrimPrefix(src, "/data")})
+	}
+
+	if len(skipped) > 0 {
+		logging.Post("kemono", basePID).Info("skipped non-image attachments", "count", len(skipped), "files", strings.Join(skipped, ", "))
+	}
+
+	note := "Service: " + kResp.Post.Service
+	if len(skipped) > 0 {
+		note += fmt.Sprintf("\n📎 未转存附件: %s", strings.Join(skipped, ", "))
+	}
+	// 拿不到宽高，只按标签和作者过滤
+	meta := filter.Meta{Source: "kemono", ID: basePID, Tags: kResp.Post.Tags, Artist: kResp.Post.User}
+	if !botHandler.Filter.Allow(meta) {
+		return false, errKemonoFiltered
+	}
+	// 演练只看元数据时算处理完，记进 History 副本，下一轮不再重复打印
+	if botHandler.DryRunSkip(ctx, meta) {
+		return true, nil
+	}
+
+	// Kemono 没有分级字段，标签里没写就按平台默认分级
+	rate := rating.FromTags(kResp.Post.Tags, defaultRating)
 
+	complete := true
+
+	// 下载每一张图
+	for idx, imgURL := range imageURLs {
 		// 构建唯一的子图 ID
 		subPID := fmt.Sprintf("%s_p%d", basePID, idx)
-		
+
 		// 检查子图是否发过（断点续传的关键）
-		if db.History[subPID] {
+		if db.CheckExists(subPID) {
 			continue
 		}
 
-		server := cdnMap[att.Path]
-		if server == "" {
-			server = "https://n4.kemono.cr"
-		}
-		imgURL := server + "/data" + att.Path
-
-		log.Printf("⬇️ Downloading Kemono: %s", imgURL)
-		imgResp, err := client.R().SetContext(ctx).Get(imgURL)
-		if err != nil || imgResp.StatusCode() != 200 {
-			log.Printf("❌ Kemono image error: %v", err)
+		logger := logging.Post("kemono", subPID)
+		logger.Info("downloading", "page", idx, "url", imgURL)
+		data, err := downloadKemonoImage(ctx, client, imgURL)
+		if err != nil {
+			logger.Warn("download failed", "page", idx, "err", err)
+			complete = false
 			continue
 		}
-		data := imgResp.Body()
 
 		// 解码宽高
 		width, height := 0, 0
@@ -178,16 +335,39 @@ func fetchKemonoPost(
 			width, height = cfg.Width, cfg.Height
 		}
 
-		caption := fmt.Sprintf("Kemono: %s\nService: %s\nUser: %s\nPost: %s",
-			kResp.Post.Title, kResp.Post.Service, kResp.Post.User, kResp.Post.ID)
-		tagsStr := strings.Join(kResp.Post.Tags, " ")
+		botHandler.ProcessAndSend(ctx, data, database.ImageMeta{
+			PostID:    subPID,
+			ArtworkID: basePID,
+			PageIndex: idx,
+			PageCount: len(imageURLs),
+			Source:    "kemono",
+			SourceURL: fmt.Sprintf("%s/%s/user/%s/post/%s", base, service, uid, postID),
+			Title:     kResp.Post.Title,
+			Note:      note,
+			ArtistID:  service + ":" + uid,
+			Artist:    kResp.Post.User,
+			Rating:    rate,
+			Tags:      database.NewTags(database.TagGeneral, kResp.Post.Tags...),
+			Width:     width,
+			Height:    height,
+		})
 
-		botHandler.ProcessAndSend(ctx, data, subPID, tagsStr, caption, kResp.Post.User, "kemono", width, height)
-		
-		// ✅ 【关键修改】每张子图发完，立刻推送到 D1
+		// ✅ 每张子图发完，立刻推送到 D1
 		// 这样如果图片很多，下载到一半挂了，下次也不会重复发前几张
 		db.PushHistory()
 	}
 
-	return nil
+	return complete, nil
+}
+
+// downloadKemonoImage 下载单个附件，失败重试由 client 负责
+func downloadKemonoImage(ctx context.Context, client *resty.Client, imgURL string) ([]byte, error) {
+	imgResp, err := client.R().SetContext(ctx).Get(imgURL)
+	if err != nil {
+		return nil, err
+	}
+	if imgResp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d", imgResp.StatusCode())
+	}
+	return imgResp.Body(), nil
 }
@@ -4,12 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
 	"my-bot-go/internal/manyacg"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
-	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -20,7 +21,9 @@ type ManyACGResponse struct {
 	Data []struct {
 		ID       string `json:"id"` 
 		Title    string `json:"title"`
+		SourceURL string `json:"source_url"`
 		Artist   struct {
+			ID   string `json:"id"`
 			Name string `json:"name"`
 		} `json:"artist"`
 		Pictures []struct {
@@ -40,13 +43,14 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
 	client.SetTimeout(60 * time.Second)
 	client.SetRetryCount(3)
 	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0")
+	logger := logging.Source("mtcacg")
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🎲 Starting Batch ManyACG (10 Pics)...")
+			logger.Info("cycle start", "batch", 10)
 
 			//  批量抽 10 次
 			for i := 0; i < 10; i++ {
@@ -54,13 +58,13 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
 
 				resp, err := client.R().Get(url)
 				if err != nil {
-					log.Printf("ManyACG API Error: %v", err)
+					logger.Warn("api request failed", "err", err)
 					continue
 				}
 
 				var result ManyACGResponse
 				if err := json.Unmarshal(resp.Body(), &result); err != nil {
-					log.Printf("ManyACG JSON Error: %v", err)
+					logger.Warn("api response decode failed", "err", err)
 					continue
 				}
 
@@ -69,7 +73,7 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
                     firstPid := fmt.Sprintf("mtcacg_%s_p0", item.ID)
 
                     if db.CheckExists(firstPid) {
-                        log.Printf("♻️ MtcACG random skip (already in mtcacg_all): %s [p0 exists]", item.ID)
+                        logger.Debug("skip, already in db", "post_id", firstPid)
                         continue
                     }
 
@@ -84,13 +88,25 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
 
                         // 3) 单张子图去重检查
                         if db.CheckExists(pid) {
-                            log.Printf("♻️ MtcACG random skip duplicate: %s", pid)
+                            logger.Debug("skip, already in db", "post_id", pid)
+                            continue
+                        }
+
+                        meta := filter.Meta{Source: "mtcacg", ID: pid, Tags: item.Tags, Artist: item.Artist.Name, Width: pic.Width, Height: pic.Height}
+                        if !botHandler.Filter.Allow(meta) {
+                            continue
+                        }
+                        if botHandler.DryRunSkip(ctx, meta) {
                             continue
                         }
 
                         imgData, err := manyacg.DownloadOriginal(ctx, pic.ID)
-                        if err != nil || len(imgData) == 0 {
-                            log.Printf("❌ MtcACGR original failed: %v (picID=%s)", err, pic.ID)
+                        if err != nil {
+                            logger.Warn("download failed", "post_id", pid, "page", pic.Index, "pic_id", pic.ID, "err", err)
+                            continue
+                        }
+                        if len(imgData) == 0 {
+                            logger.Warn("download returned empty body", "post_id", pid, "page", pic.Index, "pic_id", pic.ID)
                             continue
                         }
 
@@ -98,16 +114,6 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
                         width := pic.Width
                         height := pic.Height
 
-                        // 1. 截断 tags（避免 caption 太长）
-                        maxTags := 20
-                        tags := item.Tags
-                        if item.R18 {
-                            tags = append(tags, "R-18")
-                        }
-                        if len(tags) > maxTags {
-                            tags = tags[:maxTags]
-                        }
-
 
                          // 2. 压缩图片尺寸（避免 Telegram 尺寸超限）
                         maxSize := 4000
@@ -122,23 +128,22 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
                             }
 
 
-                        log.Printf("⬇️ MtcACG random [%s] P%d (%dx%d, pid=%s)", item.Title, pic.Index, width, height, pid)
-
-                        tagsStr := strings.Join(tags, " ")
-                        hashTags := ""
-                        if len(tags) > 0 {
-                            hashTags = "#" + strings.Join(tags, " #")
-                        }
-
-                        caption := fmt.Sprintf(
-                            "MtcACG: %s [P%d/%d]\nArtist: %s\nTags: %s",
-                            item.Title,
-                            pic.Index+1, len(item.Pictures),
-                            item.Artist.Name,
-                            hashTags,
-                        )
-
-                        botHandler.ProcessAndSend(ctx, imgData, pid, tagsStr, caption, item.Artist.Name, "mtcacg", width, height)
+                        logger.Info("downloaded", "post_id", pid, "page", pic.Index, "title", item.Title, "width", width, "height", height)
+
+                        botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+                            PostID:    pid,
+                            PageIndex: pic.Index,
+                            Source:    "mtcacg",
+                            SourceURL: item.SourceURL,
+                            PageCount: len(item.Pictures),
+                            Title:     item.Title,
+                            ArtistID:  item.Artist.ID,
+                            Artist:    item.Artist.Name,
+                            Rating:    rating.FromFlag(item.R18),
+                            Tags:      database.NewTags(database.TagGeneral, item.Tags...),
+                            Width:     width,
+                            Height:    height,
+                        })
                         db.History[pid] = true
                         db.PushHistory()
 
@@ -150,8 +155,10 @@ func StartManyACG(ctx context.Context, cfg *config.Config, db *database.D1Client
 			            time.Sleep(3 * time.Second)
 			    }
 
-			log.Println("😴 ManyACG Batch Done. Sleeping 37m...")
-			time.Sleep(37 * time.Minute)
+			logger.Info("cycle done", "sleep", 37*time.Minute)
+			if !cycleDone(ctx, "mtcacg", 37*time.Minute) {
+				return
+			}
 		}
 	}
 }
@@ -4,13 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
 	"my-bot-go/internal/manyacg"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
 
 	"github.com/go-resty/resty/v2"
@@ -67,7 +69,8 @@ func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Cli
 	// r18 参数：0=非R18，1=R18，2=全部
 	r18Param := "2"
 
-	log.Println("🚀 Starting MtcACG All Crawler...")
+	logger := logging.Source("mtcacg_all")
+	logger.Info("starting", "pages_per_round", maxPagePerRound)
 
 	for {
 		select {
@@ -77,13 +80,15 @@ func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Cli
 		default:
 			    
           if page > maxPagePerRound {
-              log.Printf("🔚 MtcACG one round done (1-%d), sleep 30m...", maxPagePerRound)
+              logger.Info("cycle done", "pages", maxPagePerRound, "sleep", 120*time.Minute)
               page = 1
-              time.Sleep(120 * time.Minute)
+              if !cycleDone(ctx, "mtcacg_all", 120*time.Minute) {
+                  return
+              }
               continue
           }
                
-			log.Printf("📜 MtcACG list page=%d, r18=%s ...", page, r18Param)
+			logger.Info("checking list", "list_page", page, "r18", r18Param)
 
 			apiURL := "https://api.manyacg.top/v1/artwork/list"
 			resp, err := client.R().
@@ -95,23 +100,31 @@ func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Cli
 				}).
 				Get(apiURL)
 
-			if err != nil || resp.StatusCode() != 200 {
-				log.Printf("❌ ManyACG list error: %v (status=%d)", err, resp.StatusCode())
+			// 请求出错时 resp 可能是 nil，不能再取状态码
+			if err != nil {
+				logger.Warn("list request failed", "list_page", page, "err", err)
+				time.Sleep(15 * time.Second)
+				continue
+			}
+			if resp.StatusCode() != 200 {
+				logger.Warn("list request failed", "list_page", page, "status", resp.StatusCode())
 				time.Sleep(15 * time.Second)
 				continue
 			}
 
 			var list ManyACGListResp
 			if err := json.Unmarshal(resp.Body(), &list); err != nil {
-				log.Printf("❌ ManyACG list JSON error: %v", err)
+				logger.Warn("list decode failed", "list_page", page, "err", err)
 				time.Sleep(15 * time.Second)
 				continue
 			}
 
 			if len(list.Data) == 0 {
-				log.Printf("🏁 ManyACG page %d has no data, reset to page=1 and sleep 30m...", page)
+				logger.Info("cycle done, list page has no data", "list_page", page, "sleep", 30*time.Minute)
 				page = 1
-				time.Sleep(30 * time.Minute)
+				if !cycleDone(ctx, "mtcacg_all", 30*time.Minute) {
+					return
+				}
 				continue
 			}
 
@@ -130,13 +143,6 @@ func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Cli
 						continue
 					}
 
-					// 1. 截断 tags（避免 caption 太长）
-                 tags := aw.Tags
-                    maxTags := 20
-                    if len(tags) > maxTags {
-                    tags = tags[:maxTags]
-                    }
-
 						width := pic.Width
 					    height := pic.Height
 
@@ -158,45 +164,53 @@ func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Cli
 
                     if db.CheckExists(pid) {
                        // 可选：加一行提示
-                      log.Printf("♻️ MtcACG_all skip duplicate: %s", pid)
+                      logger.Debug("skip, already in db", "post_id", pid)
                       continue
                     }
 
+					meta := filter.Meta{Source: "mtcacg", ID: pid, Tags: aw.Tags, Artist: aw.Artist.Name, Width: pic.Width, Height: pic.Height}
+					if !botHandler.Filter.Allow(meta) {
+						continue
+					}
+					if botHandler.DryRunSkip(ctx, meta) {
+						continue
+					}
+
 					// 3) 用 picture id 下载原图
 					imgData, err := manyacg.DownloadOriginal(ctx, pic.ID)
-					if err != nil || len(imgData) == 0 {
-						log.Printf("❌ MtcACG original failed: %v (picID=%s)", err, pic.ID)
+					if err != nil {
+						logger.Warn("download failed", "post_id", pid, "page", pic.Index, "pic_id", pic.ID, "err", err)
+						continue
+					}
+					if len(imgData) == 0 {
+						logger.Warn("download returned empty body", "post_id", pid, "page", pic.Index, "pic_id", pic.ID)
 						continue
 					}
 
-					log.Printf("⬇️ ManyACG [%s] P%d (%dx%d, pid=%s)", aw.Title, pic.Index, width, height, pid)
-
-					// 4) 组装标签 / caption
-                    tagsStr := strings.Join(tags, " ")
-                    hashTags := ""
-                    if len(tags) > 0 {
-                        hashTags = "#" + strings.Join(tags, " #")
-                    }
-
+					logger.Info("downloaded", "post_id", pid, "page", pic.Index, "title", aw.Title, "width", width, "height", height)
 
+					// 4) 来源平台
 					source := "mtcacg"
 					if aw.SourceType != "" {
 						source = aw.SourceType
 					}
 
-					caption := fmt.Sprintf(
-						"MtcACG: %s [P%d/%d]\nArtist: %s\nSource: %s\nPlatform: %s\nTags: %s",
-						strings.TrimSpace(aw.Title),
-						pic.Index+1, len(aw.Pictures),
-						strings.TrimSpace(aw.Artist.Name),
-						aw.SourceURL,
-						source,
-						hashTags,
-					)
-
-
 					// 5) 发送并存库
-					botHandler.ProcessAndSend(ctx, imgData, pid, tagsStr, caption, aw.Artist.Name, source, width, height)
+					botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+						PostID:    pid,
+						PageIndex: pic.Index,
+						Source:    source,
+						SourceURL: aw.SourceURL,
+						PageCount: len(aw.Pictures),
+						Title:     strings.TrimSpace(aw.Title),
+						Note:      "via MtcACG",
+						ArtistID:  aw.Artist.ID,
+						Artist:    aw.Artist.Name,
+						Rating:    rating.FromFlag(aw.R18),
+						Tags:      database.NewTags(database.TagGeneral, aw.Tags...),
+						Width:     width,
+						Height:    height,
+					})
 					db.History[pid] = true
 					db.PushHistory()
 
@@ -0,0 +1,25 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	"my-bot-go/internal/metrics"
+)
+
+type onceKey struct{}
+
+// WithOnce 爬虫跑完一轮就返回，不再睡到下一轮，命令行的 bot crawl --once 用
+func WithOnce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, onceKey{}, true)
+}
+
+// cycleDone 一轮结束：记下时间，--once 时返回 false 让爬虫退出，否则睡到下一轮
+func cycleDone(ctx context.Context, name string, sleep time.Duration) bool {
+	metrics.RunDone(name, sleep)
+	if once, _ := ctx.Value(onceKey{}).(bool); once {
+		return false
+	}
+	time.Sleep(sleep)
+	return true
+}
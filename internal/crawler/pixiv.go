@@ -4,13 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
 	"my-bot-go/internal/telegram"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -35,7 +36,9 @@ type PixivDetailResp struct {
 		IllustId   string `json:"illustId"`
 		IllustTitle string `json:"illustTitle"`
 		UserName   string `json:"userName"`
+		UserId     string `json:"userId"`
 		IllustType int    `json:"illustType"` 
+		XRestrict  int    `json:"xRestrict"`
 		Tags       struct {
 			Tags []struct {
 				Tag string `json:"tag"`
@@ -51,19 +54,24 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 	client.SetHeader("Cookie", "PHPSESSID="+cfg.PixivPHPSESSID)
 	// 建议把超时设长一点
 	client.SetTimeout(60 * time.Second)
+	logger := logging.Source("pixiv")
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🍪 Checking Pixiv (Cookie Mode)...")
+			logger.Info("cycle start")
 
 			for _, uid := range cfg.PixivArtistIDs {
 				// 1. 获取画师所有作品列表
 				resp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/user/%s/profile/all", uid))
-				if err != nil || resp.StatusCode() != 200 {
-					log.Printf("⚠️ Pixiv User %s Error: %v", uid, err)
+				if err != nil {
+					logger.Warn("get user works failed", "user", uid, "err", err)
+					continue
+				}
+				if resp.StatusCode() != 200 {
+					logger.Warn("get user works failed", "user", uid, "status", resp.StatusCode())
 					continue
 				}
 
@@ -87,7 +95,7 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 
 				// 检查是否超过了回溯范围，太旧了，直接跳出循环
                 if cfg.PixivCrawlRange > 0 && i >= cfg.PixivCrawlRange {
-                 log.Printf("🛑 触达回溯限制 (%d/%d)，停止处理画师 %s 的旧图", i, cfg.PixivCrawlRange, uid)
+                 logger.Debug("crawl range reached", "user", uid, "range", cfg.PixivCrawlRange)
                  break 
                  }
 					
@@ -101,7 +109,7 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 						continue
 					}
 
-					log.Printf("🔍 Processing Pixiv ID: %d", id)
+					logger.Info("processing", "post_id", fmt.Sprintf("pixiv_%d", id))
 
 					// 2. 获取详情
 					detailResp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d", id))
@@ -114,7 +122,7 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 					
 					// 如果是动图，暂时跳过
 					if detail.Body.IllustType == 2 {
-						log.Printf("⚠️ Skip Ugoira (GIF): %d", id)
+						logger.Info("skip ugoira", "post_id", fmt.Sprintf("pixiv_%d", id))
 						db.History[mainPid] = true
 						continue 
 					}
@@ -124,7 +132,6 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 					for _, t := range detail.Body.Tags.Tags {
 						tagStrs = append(tagStrs, t.Tag)
 					}
-					tagsStr := strings.Join(tagStrs, " ")
 					
 					// 关键升级：获取 Pages
 					pagesResp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d/pages?lang=zh", id))
@@ -150,21 +157,39 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 							continue
 						}
 
-						log.Printf("⬇️ Downloading Pixiv: %s (P%d)", detail.Body.IllustTitle, i)
+						meta := filter.Meta{Source: "pixiv", ID: subPid, Tags: tagStrs, Artist: detail.Body.UserName, Width: page.Width, Height: page.Height}
+						if !botHandler.Filter.Allow(meta) {
+							continue
+						}
+						if botHandler.DryRunSkip(ctx, meta) {
+							continue
+						}
+
+						logger.Info("downloading", "post_id", subPid, "page", i, "title", detail.Body.IllustTitle)
 						
 						imgResp, err := client.R().Get(page.Urls.Original)
-						if err != nil || imgResp.StatusCode() != 200 {
-							log.Printf("❌ Download failed: %v", err)
+						if err != nil {
+							logger.Warn("download failed", "post_id", subPid, "page", i, "err", err)
+							continue
+						}
+						if imgResp.StatusCode() != 200 {
+							logger.Warn("download failed", "post_id", subPid, "page", i, "status", imgResp.StatusCode())
 							continue
 						}
 
-						// 构造标题
-						caption := fmt.Sprintf("Pixiv: %s [P%d/%d]\nArtist: %s\nTags: #%s", 
-							detail.Body.IllustTitle, i+1, len(pages.Body), 
-							detail.Body.UserName, 
-							strings.ReplaceAll(tagsStr, " ", " #"))
-
-						botHandler.ProcessAndSend(ctx, imgResp.Body(), subPid, tagsStr, caption, detail.Body.UserName, "pixiv", page.Width, page.Height)
+						botHandler.ProcessAndSend(ctx, imgResp.Body(), database.ImageMeta{
+							PostID:    subPid,
+							Source:    "pixiv",
+							SourceURL: fmt.Sprintf("https://www.pixiv.net/artworks/%d", id),
+							PageCount: len(pages.Body),
+							Title:     detail.Body.IllustTitle,
+							ArtistID:  detail.Body.UserId,
+							Artist:    detail.Body.UserName,
+							Rating:    rating.FromPixiv(detail.Body.XRestrict),
+							Tags:      database.NewTags(database.TagGeneral, tagStrs...),
+							Width:     page.Width,
+							Height:    page.Height,
+						})
 						
 						time.Sleep(18 * time.Second) // 防被ban
 					}
@@ -176,8 +201,10 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 			}
 
 			
-			log.Println("😴 Pixiv Done. Sleeping 73m...")
-			time.Sleep(73 * time.Minute)
+			logger.Info("cycle done", "sleep", 73*time.Minute)
+			if !cycleDone(ctx, "pixiv", 73*time.Minute) {
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/telegram"
+	"my-bot-go/internal/twitter"
+)
+
+// StartTwitter 巡逻配置账号的媒体时间线和点赞列表
+func StartTwitter(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("twitter")
+	if cfg.TwitterCookie == "" || (len(cfg.TwitterUsers) == 0 && len(cfg.TwitterLikesUsers) == 0) {
+		logger.Info("disabled, no cookie or users configured")
+		return
+	}
+
+	// screen_name -> rest_id，解析一次就够了
+	userIDs := make(map[string]string)
+	resolve := func(screenName string) (string, error) {
+		if uid, ok := userIDs[screenName]; ok {
+			return uid, nil
+		}
+		uid, err := twitter.GetUserID(screenName, cfg.TwitterCookie, cfg.TwitterCT0, cfg.TwitterUserQueryID)
+		if err != nil {
+			return "", err
+		}
+		userIDs[screenName] = uid
+		return uid, nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			logger.Info("cycle start")
+
+			for _, name := range cfg.TwitterUsers {
+				uid, err := resolve(name)
+				if err != nil {
+					logger.Warn("resolve user failed", "user", name, "err", err)
+					continue
+				}
+				tweets, err := twitter.GetUserMedia(uid, cfg.TwitterCookie, cfg.TwitterCT0, cfg.TwitterMediaQueryID, cfg.TwitterLimit)
+				if err != nil {
+					logger.Warn("media timeline failed", "user", name, "err", err)
+					continue
+				}
+				logger.Info("media timeline", "user", name, "tweets", len(tweets))
+				for _, t := range tweets {
+					processTweet(ctx, cfg, t, db, botHandler)
+				}
+				time.Sleep(10 * time.Second)
+			}
+
+			for _, name := range cfg.TwitterLikesUsers {
+				uid, err := resolve(name)
+				if err != nil {
+					logger.Warn("resolve user failed", "user", name, "err", err)
+					continue
+				}
+				tweets, err := twitter.GetLikes(uid, cfg.TwitterCookie, cfg.TwitterCT0, cfg.TwitterLikesQueryID, cfg.TwitterLimit)
+				if err != nil {
+					logger.Warn("likes failed", "user", name, "err", err)
+					continue
+				}
+				logger.Info("likes", "user", name, "tweets", len(tweets))
+				for _, t := range tweets {
+					processTweet(ctx, cfg, t, db, botHandler)
+				}
+				time.Sleep(10 * time.Second)
+			}
+
+			logger.Info("cycle done", "sleep", 47*time.Minute)
+			if !cycleDone(ctx, "twitter", 47*time.Minute) {
+				return
+			}
+		}
+	}
+}
+
+// processTweet 把一条推文的每张图当作一页发送，ID 为 twitter_{tweetID}_p{index}
+func processTweet(ctx context.Context, cfg *config.Config, t *twitter.Tweet, db *database.D1Client, botHandler *telegram.BotHandler) {
+	for i, photo := range t.Photos {
+		pid := fmt.Sprintf("twitter_%s_p%d", t.ID, i)
+		if db.CheckExists(pid) {
+			continue
+		}
+
+		meta := filter.Meta{Source: "twitter", ID: pid, Tags: t.Hashtags, Artist: t.Author, Width: photo.Width, Height: photo.Height}
+		if !botHandler.Filter.Allow(meta) {
+			continue
+		}
+		if botHandler.DryRunSkip(ctx, meta) {
+			continue
+		}
+
+		logger := logging.Post("twitter", pid)
+		logger.Info("downloading", "page", i)
+		imgData, err := twitter.DownloadImage(photo.URL, cfg.TwitterCookie)
+		if err != nil {
+			logger.Warn("download failed", "page", i, "err", err)
+			continue
+		}
+
+		botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "twitter",
+			SourceURL: t.URL(),
+			PageCount: len(t.Photos),
+			Title:     t.Title(),
+			ArtistID:  t.Author,
+			Artist:    t.Author,
+			Rating:    rating.FromFlag(t.Sensitive),
+			Tags:      database.NewTags(database.TagGeneral, t.Hashtags...),
+			Width:     photo.Width,
+			Height:    photo.Height,
+		})
+		time.Sleep(5 * time.Second)
+	}
+
+	db.PushHistory()
+}
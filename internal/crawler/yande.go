@@ -2,11 +2,10 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/logging"
 	"my-bot-go/internal/telegram"
 	"strings"
 	"time"
@@ -14,33 +13,21 @@ import (
 	"github.com/go-resty/resty/v2"
 )
 
-type YandePost struct {
-	ID        int    `json:"id"`
-	ParentID  int    `json:"parent_id"`
-	SampleURL string `json:"sample_url"`
-	FileURL   string `json:"file_url"`
-	FileSize  int    `json:"file_size"`
-	Tags      string `json:"tags"`
-	Width     int    `json:"width"`
-	Height    int    `json:"height"`
-}
-
+// StartYande 按 YANDE_TAGS 巡逻 yande.re，逗号分隔多组标签
+// 请求和下载走 booru 适配器的 moebooru 方言，带父子关系的帖子会把整个家族作为一组发送
 func StartYande(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
-	client := resty.New()
-	client.SetTimeout(90 * time.Second)
-	client.SetRetryCount(3)
-	client.SetRetryWaitTime(4 * time.Second)
-	// 伪装
-	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	site := yandeSite(cfg)
+	client := newBooruClient(site)
 
 	tagGroups := strings.Split(cfg.YandeTags, ",")
+	logger := logging.Source("yande")
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			log.Println("🔄 Starting Yande Loop...")
+			logger.Info("cycle start")
 
 			//  遍历每一组任务
 			for _, tags := range tagGroups {
@@ -49,27 +36,17 @@ func StartYande(ctx context.Context, cfg *config.Config, db *database.D1Client,
 					continue
 				}
 
-				log.Printf("🔍 Checking Yande Tags: [%s] ...", currentTags)
-
-				// 构造 URL，使用当前这组标签
-				url := fmt.Sprintf("https://yande.re/post.json?limit=%d&tags=%s", cfg.YandeLimit, currentTags)
+				logger.Info("checking tags", "tags", currentTags)
 
-				resp, err := client.R().Get(url)
+				posts, err := fetchBooruPosts(client, site, currentTags, 0)
 				if err != nil {
-					log.Printf("Yande API Error (%s): %v", currentTags, err)
-					time.Sleep(10 * time.Second)
-					continue
-				}
-
-				var posts []YandePost
-				if err := json.Unmarshal(resp.Body(), &posts); err != nil {
-					log.Printf("Yande JSON Error (%s): %v", currentTags, err)
+					logger.Warn("api request failed", "tags", currentTags, "err", err)
 					time.Sleep(10 * time.Second)
 					continue
 				}
 
 				if len(posts) == 0 {
-					log.Printf("⚠️ No posts found for tags: %s", currentTags)
+					logger.Info("no posts found", "tags", currentTags)
 					continue
 				}
 
@@ -79,153 +56,121 @@ func StartYande(ctx context.Context, cfg *config.Config, db *database.D1Client,
 						continue
 					}
 
-                pid := fmt.Sprintf("yande_%d", post.ID)
-
-                // 1. 先按原始 ID 查 (防止单图逻辑变动)
-                if db.CheckExists(pid) {
-                       continue
-                    }
-
-                targetCheckID := post.ID
-                if post.ParentID != 0 {
-                   targetCheckID = post.ParentID
-                    }
-                // 构造 _p0 格式的 ID
-                pidP0 := fmt.Sprintf("yande_%d_p0", targetCheckID)
-
-                if db.CheckExists(pidP0) {
-                // 把原始 ID 也补进内存
-                   db.History[pid] = true 
-					log.Printf("♻️ Skip Family Group (Parent: %d) - Already in DB", targetCheckID)
-                   continue
-                   }
+					pid := fmt.Sprintf("yande_%d", post.ID)
 
+					// 1. 先按原始 ID 查 (防止单图逻辑变动)
+					if db.CheckExists(pid) {
+						continue
+					}
 
+					// 元数据过滤，不通过就不去拉整个家族
+					if !botHandler.Filter.Allow(post.filterMeta(site.Name)) {
+						processedInLoop[post.ID] = true
+						continue
+					}
+					if botHandler.DryRunSkip(ctx, post.filterMeta(site.Name)) {
+						processedInLoop[post.ID] = true
+						continue
+					}
 
 					targetID := post.ID
 					if post.ParentID != 0 {
 						targetID = post.ParentID
 					}
 
+					// 构造 _p0 格式的 ID
+					pidP0 := fmt.Sprintf("yande_%d_p0", targetID)
+					if db.CheckExists(pidP0) {
+						// 把原始 ID 也补进内存
+						db.MarkHistory(pid)
+						logger.Debug("skip family, already in db", "post_id", pidP0)
+						continue
+					}
+
 					// 确保包含父图
-					familyPosts := fetchFamilyWithParent(client, targetID)
+					familyPosts := fetchFamilyWithParent(client, site, targetID)
 					if len(familyPosts) == 0 {
 						// 兜底
-						familyPosts = []YandePost{post}
+						familyPosts = []BooruPost{post}
 					}
 
 					// 处理单图或套图
 					if len(familyPosts) == 1 {
 						p := familyPosts[0]
-						processSingleImage(ctx, client, p, db, botHandler)
+						sendBooruPost(ctx, client, site, p, db, botHandler)
 						processedInLoop[p.ID] = true
-						db.History[fmt.Sprintf("yande_%d", p.ID)] = true
+						db.MarkHistory(fmt.Sprintf("yande_%d", p.ID))
 					} else {
 						// 传入 targetID (父ID) 用于生成统一格式的 ID
-						processMediaGroup(ctx, client, familyPosts, targetID, db, botHandler)
+						processMediaGroup(ctx, client, site, familyPosts, targetID, botHandler)
 						for _, p := range familyPosts {
 							processedInLoop[p.ID] = true
-							db.History[fmt.Sprintf("yande_%d", p.ID)] = true
+							db.MarkHistory(fmt.Sprintf("yande_%d", p.ID))
 						}
 					}
-					
+
 					// ✅ 每处理完一组图，立即保存历史到云端
 					db.PushHistory()
-					
+
 					time.Sleep(15 * time.Second)
 				}
 
-				log.Printf("✅ Task [%s] finished. Cooldown 10s...", currentTags)
+				logger.Info("tags done", "tags", currentTags)
 				time.Sleep(20 * time.Second)
 			}
 
 			//轮询，长睡眠
-			log.Println("😴 All Yande Tasks Done. Sleeping 80m...") 
-			time.Sleep(61 * time.Minute)
+			logger.Info("cycle done", "sleep", 61*time.Minute)
+			if !cycleDone(ctx, "yande", 61*time.Minute) {
+				return
+			}
 		}
 	}
 }
 
 //先查父图再查子图
-func fetchFamilyWithParent(client *resty.Client, parentID int) []YandePost {
-	var finalFamily []YandePost
+func fetchFamilyWithParent(client *resty.Client, site config.BooruSite, parentID int) []BooruPost {
+	var finalFamily []BooruPost
+	site.Limit = 40 // 不受 YANDE_LIMIT 限制，和 API 不带 limit 时的默认值一样
 
-
-	urlParent := fmt.Sprintf("https://yande.re/post.json?tags=id:%d", parentID)
-	respP, errP := client.R().Get(urlParent)
-	var parents []YandePost
-	if errP == nil {
-		_ = json.Unmarshal(respP.Body(), &parents)
-		if len(parents) > 0 {
-			finalFamily = append(finalFamily, parents[0])
-		}
+	if parents, err := fetchBooruPosts(client, site, fmt.Sprintf("id:%d", parentID), 0); err == nil && len(parents) > 0 {
+		finalFamily = append(finalFamily, parents[0])
 	}
 
 	// 获取所有子图
-	urlChildren := fmt.Sprintf("https://yande.re/post.json?tags=parent:%d", parentID)
-	respC, errC := client.R().Get(urlChildren)
-	var children []YandePost
-	if errC == nil {
-		_ = json.Unmarshal(respC.Body(), &children)
+	if children, err := fetchBooruPosts(client, site, fmt.Sprintf("parent:%d", parentID), 0); err == nil {
 		finalFamily = append(finalFamily, children...)
 	}
 
 	return finalFamily
 }
 
-func processSingleImage(ctx context.Context, client *resty.Client, post YandePost, db *database.D1Client, botHandler *telegram.BotHandler) {
-	imgURL := selectBestImageURL(post)
-	log.Printf("⬇️ Downloading Yande: %d", post.ID)
-
-	imgResp, err := client.R().Get(imgURL)
-	if err != nil {
-		log.Printf("Failed to download image: %v", err)
-		return
-	}
-
-	pid := fmt.Sprintf("yande_%d", post.ID)
-	caption := fmt.Sprintf("Yande: %d\nTags: #%s", post.ID, strings.ReplaceAll(post.Tags, " ", " #"))
-
-	botHandler.ProcessAndSend(ctx, imgResp.Body(), pid, post.Tags, caption, "Yande artist", "yande", post.Width, post.Height)
-}
-
-// 修改 ID 生成逻辑
-func processMediaGroup(ctx context.Context, client *resty.Client, posts []YandePost, parentID int, db *database.D1Client, botHandler *telegram.BotHandler) {
-	log.Printf("📦 Processing Family Group: %d (Count: %d)", parentID, len(posts))
+// processMediaGroup 套图统一用父图 ID 生成 <站点>_<父ID>_p<页> 格式的 ID
+func processMediaGroup(ctx context.Context, client *resty.Client, site config.BooruSite, posts []BooruPost, parentID int, botHandler *telegram.BotHandler) {
+	logging.Source(site.Name).Info("processing family", "post_id", fmt.Sprintf("%s_%d", site.Name, parentID), "pages", len(posts))
 
 	for i, p := range posts {
 		if i >= 10 {
 			break
 		}
-
-		imgURL := selectBestImageURL(p)
-		imgResp, err := client.R().Get(imgURL)
-		if err != nil {
+		// 套图里被过滤的单张跳过，页码保持不变
+		if !p.isImage() || !botHandler.Filter.Allow(p.filterMeta(site.Name)) {
 			continue
 		}
 
-		// 格式化 Caption
-		tags := strings.Split(p.Tags, " ")
-		firstTag := ""
-		if len(tags) > 0 {
-			firstTag = tags[0]
+		imgData, err := downloadBooruPost(client, p)
+		if err != nil {
+			continue
 		}
-		caption := fmt.Sprintf("Yande Set: %d [%d/%d]\nTags: #%s", parentID, i+1, len(posts), firstTag)
 
-		pid := fmt.Sprintf("yande_%d_p%d", parentID, i)
+		pid := fmt.Sprintf("%s_%d_p%d", site.Name, parentID, i)
 
-		botHandler.ProcessAndSend(ctx, imgResp.Body(), pid, p.Tags, caption, "Yande artist", "yande", p.Width, p.Height)
+		meta := booruMeta(site, p, pid)
+		meta.ArtworkID = fmt.Sprintf("%s_%d", site.Name, parentID)
+		meta.PageIndex = i
+		meta.PageCount = len(posts)
+		meta.Title = fmt.Sprintf("Set %d", parentID)
+		botHandler.ProcessAndSend(ctx, imgData, meta)
 		time.Sleep(1 * time.Second)
 	}
 }
-
-func selectBestImageURL(post YandePost) string {
-	const MaxSize = 13 * 1024 * 1024
-	if post.FileSize > 0 && post.FileSize < MaxSize {
-		return post.FileURL
-	}
-	if post.SampleURL == "" {
-		return post.FileURL
-	}
-	return post.SampleURL
-}
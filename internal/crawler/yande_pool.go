@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/telegram"
+	"my-bot-go/internal/yande"
+)
+
+// StartYandePools 定期检查关注的 yande.re 图集，图集新增的图会按顺序补发
+func StartYandePools(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+	logger := logging.Source("yande_pool")
+	if len(cfg.YandePoolIDs) == 0 {
+		logger.Info("disabled, no pool ids configured")
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			logger.Info("cycle start")
+
+			for _, poolID := range cfg.YandePoolIDs {
+				sent, _, err := processYandePool(ctx, poolID, db, botHandler)
+				if err != nil {
+					logger.Warn("pool failed", "pool", poolID, "err", err)
+					continue
+				}
+				if sent > 0 {
+					logger.Info("pool updated", "pool", poolID, "sent", sent)
+				}
+				time.Sleep(20 * time.Second)
+			}
+
+			logger.Info("cycle done", "sleep", 6*time.Hour)
+			if !cycleDone(ctx, "yande_pool", 6*time.Hour) {
+				return
+			}
+		}
+	}
+}
+
+// processYandePool 把整个图集当作一个多页作品发送，ID 为 yande_pool_{poolID}_p{index}
+func processYandePool(ctx context.Context, poolID string, db *database.D1Client, botHandler *telegram.BotHandler) (int, int, error) {
+	pool, err := yande.GetYandePool(poolID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	logger := logging.Source("yande_pool")
+	logger.Info("processing pool", "pool", pool.ID, "name", pool.Name, "pages", len(pool.Posts))
+
+	// 图集名里用下划线代替空格
+	title := strings.ReplaceAll(pool.Name, "_", " ")
+
+	sent, skipped := 0, 0
+	for i, p := range pool.Posts {
+		pid := fmt.Sprintf("yande_pool_%d_p%d", pool.ID, i)
+		if db.CheckExists(pid) {
+			skipped++
+			continue
+		}
+
+		meta := filter.Meta{Source: "yande", ID: pid, Tags: strings.Fields(p.Tags), Width: p.Width, Height: p.Height}
+		if !botHandler.Filter.Allow(meta) {
+			continue
+		}
+		if botHandler.DryRunSkip(ctx, meta) {
+			continue
+		}
+
+		imgData, err := yande.DownloadYandeImage(yande.SelectBestURL(&p))
+		if err != nil {
+			logger.Warn("download failed", "post_id", pid, "page", i, "err", err)
+			continue
+		}
+
+		// yande 的 post.json 不带标签类型，分不出画师，留空
+		ok := botHandler.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "yande",
+			SourceURL: fmt.Sprintf("https://yande.re/pool/show/%d", pool.ID),
+			PageCount: len(pool.Posts),
+			Title:     "Pool " + title,
+			Note:      fmt.Sprintf("Post: %d", p.ID),
+			Rating:    rating.FromBooru(p.Rating),
+			Tags:      database.SplitTags(database.TagGeneral, p.Tags),
+			Width:     p.Width,
+			Height:    p.Height,
+		})
+		if !ok {
+			continue
+		}
+		// 单图 ID 也记下来，避免标签巡逻时再发一遍，发送失败时不记，下次还能重试
+		db.MarkHistory(fmt.Sprintf("yande_%d", p.ID))
+		db.PushHistory()
+
+		sent++
+		time.Sleep(3 * time.Second)
+	}
+
+	return sent, skipped, nil
+}
+
+// RegisterYandePoolLink 注册 yande.re/pool/show/<id> 链接处理
+func RegisterYandePoolLink(db *database.D1Client, botHandler *telegram.BotHandler) {
+	re := regexp.MustCompile(`yande\.re/pool/show/(\d+)`)
+	botHandler.RegisterLink(re, "Yande Pool", func(ctx context.Context, text string) (int, int, error) {
+		matches := re.FindStringSubmatch(text)
+		if len(matches) < 2 {
+			return 0, 0, fmt.Errorf("invalid yande pool url")
+		}
+		return processYandePool(ctx, matches[1], db, botHandler)
+	})
+}
@@ -0,0 +1,45 @@
+package danbooru
+
+import (
+	"my-bot-go/internal/database"
+	"strings"
+)
+
+// Post 对应 /posts.json 返回的字段
+type Post struct {
+	ID                 int    `json:"id"`
+	ParentID           int    `json:"parent_id"`
+	ImageWidth         int    `json:"image_width"`
+	ImageHeight        int    `json:"image_height"`
+	FileSize           int    `json:"file_size"`
+	Rating             string `json:"rating"` // g / s / q / e
+	TagString          string `json:"tag_string"`
+	TagStringArtist    string `json:"tag_string_artist"`
+	TagStringCopyright string `json:"tag_string_copyright"`
+	TagStringCharacter string `json:"tag_string_character"`
+	TagStringGeneral   string `json:"tag_string_general"`
+	FileURL            string `json:"file_url"`
+	LargeFileURL       string `json:"large_file_url"`
+	FileExt            string `json:"file_ext"` // jpg, png, mp4, webm...
+}
+
+// Artist 取第一个画师标签，没有时返回空
+func (p *Post) Artist() string {
+	if fields := strings.Fields(p.TagStringArtist); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// TagList 按 danbooru 的分类拆出结构化标签
+func (p *Post) TagList() []database.Tag {
+	var tags []database.Tag
+	tags = append(tags, database.SplitTags(database.TagArtist, p.TagStringArtist)...)
+	tags = append(tags, database.SplitTags(database.TagCopyright, p.TagStringCopyright)...)
+	tags = append(tags, database.SplitTags(database.TagCharacter, p.TagStringCharacter)...)
+	tags = append(tags, database.SplitTags(database.TagGeneral, p.TagStringGeneral)...)
+	if len(tags) == 0 {
+		tags = database.SplitTags(database.TagGeneral, p.TagString)
+	}
+	return tags
+}
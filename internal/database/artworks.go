@@ -0,0 +1,275 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"my-bot-go/internal/rating"
+)
+
+// D1 单条语句最多绑定 100 个参数
+const d1MaxParams = 100
+
+type d1Response struct {
+	Success bool `json:"success"`
+	Result  []struct {
+		Results []map[string]interface{} `json:"results"`
+		Success bool                     `json:"success"`
+	} `json:"result"`
+}
+
+// Query 执行一条 SQL，返回结果行 (也供 migrations 使用)
+func (d *D1Client) Query(sql string, params ...interface{}) ([]map[string]interface{}, error) {
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
+		d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
+
+	if params == nil {
+		params = []interface{}{}
+	}
+	body := map[string]interface{}{
+		"sql":    sql,
+		"params": params,
+	}
+
+	resp, err := d.client.R().
+		SetHeader("Authorization", "Bearer "+d.cfg.CF_APIToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("D1 Error: %s", resp.String())
+	}
+
+	var r d1Response
+	if err := json.Unmarshal(resp.Body(), &r); err != nil {
+		return nil, err
+	}
+	if !r.Success {
+		return nil, fmt.Errorf("D1 Error: %s", resp.String())
+	}
+	if len(r.Result) == 0 {
+		return nil, nil
+	}
+	return r.Result[0].Results, nil
+}
+
+// saveArtwork 写入 artworks / pages / tags / artwork_tags
+func (d *D1Client) saveArtwork(meta ImageMeta) error {
+	artworkID, pageIndex := meta.Artwork()
+	now := time.Now().Unix()
+	// 来源给了总页数就用总页数，没给的 (旧数据、单图) 至少算到当前这一页
+	pageCount := max(meta.PageCount, pageIndex+1)
+
+	_, err := d.Query(`INSERT INTO artworks (id, source, source_url, title, artist_id, artist, rating, page_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET page_count = MAX(page_count, excluded.page_count)`,
+		artworkID, meta.Source, meta.SourceURL, meta.Title, meta.ArtistID, meta.Artist, meta.Rating, pageCount, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Query(`INSERT OR REPLACE INTO pages (id, artwork_id, page_index, file_id, origin_id, width, height, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		meta.PostID, artworkID, pageIndex, meta.FileID, meta.OriginID, meta.Width, meta.Height, now)
+	if err != nil {
+		return err
+	}
+
+	return d.saveTags(artworkID, meta.Tags)
+}
+
+// saveTags 多行 VALUES 批量写入，按参数上限分批
+func (d *D1Client) saveTags(artworkID string, tags []Tag) error {
+	const perTag = 2
+	batch := (d1MaxParams - 1) / perTag
+
+	for start := 0; start < len(tags); start += batch {
+		end := start + batch
+		if end > len(tags) {
+			end = len(tags)
+		}
+		chunk := tags[start:end]
+
+		rows := make([]string, len(chunk))
+		tagParams := make([]interface{}, 0, len(chunk)*perTag)
+		linkParams := []interface{}{artworkID}
+		for i, t := range chunk {
+			rows[i] = "(?, ?)"
+			tagParams = append(tagParams, t.Name, t.Kind)
+			linkParams = append(linkParams, t.Name, t.Raw)
+		}
+		values := strings.Join(rows, ", ")
+
+		if _, err := d.Query("INSERT OR IGNORE INTO tags (name, kind) VALUES "+values, tagParams...); err != nil {
+			return err
+		}
+		_, err := d.Query(`INSERT OR IGNORE INTO artwork_tags (artwork_id, tag_id, raw)
+			SELECT ?, t.id, v.column2 FROM (VALUES `+values+`) AS v JOIN tags t ON t.name = v.column1`, linkParams...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *D1Client) deletePage(postID string) error {
+	meta := ImageMeta{PostID: postID}
+	artworkID, _ := meta.Artwork()
+
+	if _, err := d.Query("DELETE FROM pages WHERE id = ?", postID); err != nil {
+		return err
+	}
+	rows, err := d.Query("SELECT 1 FROM pages WHERE artwork_id = ? LIMIT 1", artworkID)
+	if err != nil || len(rows) > 0 {
+		return err
+	}
+	if _, err := d.Query("DELETE FROM artwork_tags WHERE artwork_id = ?", artworkID); err != nil {
+		return err
+	}
+	_, err = d.Query("DELETE FROM artworks WHERE id = ?", artworkID)
+	return err
+}
+
+// LoadImage 读出一张已发布图片的元数据，结构化表里有记录时以结构化表为准
+func (d *D1Client) LoadImage(postID string) (*ImageMeta, error) {
+	rows, err := d.Query("SELECT * FROM images WHERE id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s not found", postID)
+	}
+	meta := legacyMeta(rows[0])
+
+	rows, err = d.Query(`SELECT p.artwork_id, p.page_index, a.source, a.source_url, a.title, a.artist_id, a.page_count
+		FROM pages p JOIN artworks a ON a.id = p.artwork_id WHERE p.id = ?`, postID)
+	if err != nil || len(rows) == 0 {
+		return &meta, err
+	}
+	row := rows[0]
+	str := func(k string) string {
+		v, _ := row[k].(string)
+		return v
+	}
+	pageIndex, _ := row["page_index"].(float64)
+	pageCount, _ := row["page_count"].(float64)
+	meta.ArtworkID, meta.PageIndex, meta.PageCount = str("artwork_id"), int(pageIndex), int(pageCount)
+	meta.SourceURL, meta.Title, meta.ArtistID = str("source_url"), str("title"), str("artist_id")
+	if src := str("source"); src != "" {
+		meta.Source = src
+	}
+
+	rows, err = d.Query(`SELECT t.name, t.kind, at.raw FROM artwork_tags at JOIN tags t ON t.id = at.tag_id
+		WHERE at.artwork_id = ?`, meta.ArtworkID)
+	if err != nil {
+		return &meta, err
+	}
+	if len(rows) > 0 {
+		meta.Tags = nil
+		for _, r := range rows {
+			name, _ := r["name"].(string)
+			kind, _ := r["kind"].(string)
+			raw, _ := r["raw"].(string)
+			meta.Tags = append(meta.Tags, Tag{Name: name, Raw: raw, Kind: kind})
+		}
+	}
+	return &meta, nil
+}
+
+// UpdateImage 修改已发布图片的说明、作者和标签
+// 标题、作者、标签在结构化表里按作品存，改一页会影响同一作品的所有页
+func (d *D1Client) UpdateImage(meta ImageMeta) error {
+	rawNames := make([]string, 0, len(meta.Tags))
+	for _, t := range meta.Tags {
+		rawNames = append(rawNames, t.Raw)
+	}
+	_, err := d.Query("UPDATE images SET caption = ?, artist = ?, tags = ?, raw_tags = ?, rating = ? WHERE id = ?",
+		meta.Caption, meta.Artist, meta.LegacyTags(), strings.Join(rawNames, " "), meta.Rating, meta.PostID)
+	if err != nil {
+		return err
+	}
+
+	artworkID, _ := meta.Artwork()
+	if _, err := d.Query("UPDATE artworks SET title = ?, artist = ?, rating = ? WHERE id = ?",
+		meta.Title, meta.Artist, meta.Rating, artworkID); err != nil {
+		return err
+	}
+	if _, err := d.Query("DELETE FROM artwork_tags WHERE artwork_id = ?", artworkID); err != nil {
+		return err
+	}
+	return d.saveTags(artworkID, meta.Tags)
+}
+
+// MigrateLegacy 把旧 images 表里还没有 pages 记录的行解析成结构化数据
+// 旧 tags 列是 "标签 标签 ... 来源"，最后一个词是来源
+func (d *D1Client) MigrateLegacy(progress func(done int)) (int, error) {
+	done := 0
+	for {
+		rows, err := d.Query(`SELECT id, file_name, origin_id, caption, artist, tags, raw_tags, rating, width, height
+			FROM images WHERE id NOT IN (SELECT id FROM pages) LIMIT 100`)
+		if err != nil {
+			return done, err
+		}
+		if len(rows) == 0 {
+			return done, nil
+		}
+
+		for _, row := range rows {
+			meta := legacyMeta(row)
+			if err := d.saveArtwork(meta); err != nil {
+				return done, fmt.Errorf("%s: %w", meta.PostID, err)
+			}
+			done++
+		}
+		if progress != nil {
+			progress(done)
+		}
+	}
+}
+
+func legacyMeta(row map[string]interface{}) ImageMeta {
+	str := func(k string) string {
+		if v, ok := row[k].(string); ok {
+			return v
+		}
+		return ""
+	}
+	num := func(k string) int {
+		if v, ok := row[k].(float64); ok {
+			return int(v)
+		}
+		return 0
+	}
+
+	meta := ImageMeta{
+		PostID:   str("id"),
+		FileID:   str("file_name"),
+		OriginID: str("origin_id"),
+		Caption:  str("caption"),
+		Artist:   str("artist"),
+		Width:    num("width"),
+		Height:   num("height"),
+	}
+
+	words := strings.Fields(str("tags"))
+	if len(words) > 0 {
+		meta.Source = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	meta.Tags = NewTags(TagGeneral, words...)
+
+	// raw_tags 与 tags 一一对应时保留原始写法
+	if raw := strings.Fields(str("raw_tags")); len(raw) == len(meta.Tags) {
+		for i := range meta.Tags {
+			meta.Tags[i].Raw = raw[i]
+		}
+	}
+
+	meta.Rating = rating.Normalize(str("rating"), rating.FromTags(words, rating.Safe))
+	return meta
+}
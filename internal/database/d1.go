@@ -2,8 +2,9 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"my-bot-go/internal/config"
+	"my-bot-go/internal/metrics"
 	"strings"
 	"sync"
 	"time"
@@ -17,23 +18,72 @@ type D1Client struct {
 	History map[string]bool
 	mu       sync.RWMutex
 	lastPush  time.Time
+	dryRun   bool // 演练用的副本，History 不推回 Worker
 }
 
 func NewD1Client(cfg *config.Config) *D1Client {
+	client := resty.New()
+	// 统计 D1 的请求数和错误率，History 同步走的是 Worker，不算在内
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if strings.Contains(resp.Request.URL, "/d1/database/") {
+			metrics.D1Request(resp.IsError(), resp.Time())
+			if resp.IsError() {
+				slog.Warn("d1 request failed", "sql", requestSQL(resp.Request), "status", resp.StatusCode(), "took", resp.Time(), "body", resp.String())
+			} else {
+				slog.Debug("d1 request", "sql", requestSQL(resp.Request), "status", resp.StatusCode(), "took", resp.Time())
+			}
+		}
+		return nil
+	})
+	client.OnError(func(req *resty.Request, err error) {
+		if strings.Contains(req.URL, "/d1/database/") {
+			metrics.D1Request(true, 0)
+			slog.Warn("d1 request failed", "sql", requestSQL(req), "err", err)
+		}
+	})
+
 	return &D1Client{
-		client:  resty.New(),
+		client:  client,
 		cfg:     cfg,
 		History: make(map[string]bool),
 	}
 }
 
+// requestSQL 从请求体里取出 SQL 给日志用，所有 D1 请求的请求体都是 {"sql", "params"}
+func requestSQL(req *resty.Request) string {
+	if body, ok := req.Body.(map[string]interface{}); ok {
+		if sql, ok := body["sql"].(string); ok {
+			return sql
+		}
+	}
+	return ""
+}
+
+// DryRun 给演练的爬虫用的副本：共用连接照常查重，History 是复制出来的，爬虫写进去的记录不会推回 Worker
+func (d *D1Client) DryRun() *D1Client {
+	d.mu.RLock()
+	history := make(map[string]bool, len(d.History))
+	for id := range d.History {
+		history[id] = true
+	}
+	d.mu.RUnlock()
+	return &D1Client{client: d.client, cfg: d.cfg, History: history, dryRun: true}
+}
+
+// HistorySize 内存里已发过的 ID 数量
+func (d *D1Client) HistorySize() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.History)
+}
+
 func (d *D1Client) SyncHistory() {
 	if d.cfg.WorkerURL == "" {
 		return
 	}
 	resp, err := d.client.R().Get(d.cfg.WorkerURL + "/api/get_history")
 	if err != nil {
-		log.Printf("⚠️ Sync history failed: %v", err)
+		slog.Warn("sync history failed", "err", err)
 		return
 	}
 	
@@ -44,12 +94,20 @@ func (d *D1Client) SyncHistory() {
 			d.History[id] = true
 		}
 	}
-	log.Printf("🧠 Synced %d items from history", len(d.History))
+	slog.Info("synced history", "count", len(d.History))
 	d.mu.Unlock() // <--- 解写锁
 }
 
+// MarkHistory 加锁记下一个已处理的 ID，其他 goroutine 可能同时在读写 History，不要直接写 map
+func (d *D1Client) MarkHistory(postID string) {
+	d.mu.Lock()
+	d.History[postID] = true
+	d.mu.Unlock()
+}
+
 func (d *D1Client) PushHistory() {
-	if d.cfg.WorkerURL == "" {
+	// 演练时不写回
+	if d.cfg.WorkerURL == "" || d.dryRun || d.cfg.DryRunFor("all") {
 		return
 	}
 	
@@ -71,22 +129,52 @@ func (d *D1Client) PushHistory() {
 		Post(d.cfg.WorkerURL + "/api/update_history")
 		
 	if err != nil {
-		log.Printf("⚠️ Push history failed: %v", err)
+		slog.Warn("push history failed", "err", err)
 	} else {
 		d.lastPush = time.Now()
-		log.Println("☁️ History updated to cloud")
+		slog.Debug("history pushed")
 	}
 }
 
-func (d *D1Client) SaveImage(postID, fileID, originID, caption, artist, tags, source string, width, height int) error {
+// FlushHistory 不管 10 秒的节流立即推送一次，退出前用
+func (d *D1Client) FlushHistory() {
+	d.lastPush = time.Time{}
+	d.PushHistory()
+}
+
+// SaveImage 写入旧的 images 表 (前端和去重还在用)，再写入结构化的 artworks / pages / tags
+func (d *D1Client) SaveImage(meta ImageMeta) error {
+	rawNames := make([]string, 0, len(meta.Tags))
+	for _, t := range meta.Tags {
+		rawNames = append(rawNames, t.Raw)
+	}
+
+	sql := "INSERT OR IGNORE INTO images (id, file_name, origin_id, caption, artist, tags, raw_tags, rating, created_at, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	params := []interface{}{meta.PostID, meta.FileID, meta.OriginID, meta.Caption, meta.Artist, meta.LegacyTags(), strings.Join(rawNames, " "), meta.Rating, time.Now().Unix(), meta.Width, meta.Height}
+
+	if _, err := d.Query(sql, params...); err != nil {
+		return err
+	}
+
+	d.mu.Lock() // <--- 加写锁
+	d.History[meta.PostID] = true
+	d.mu.Unlock() // <--- 解写锁
+
+	// 结构化数据写失败不影响发图和去重，下次 /migrate 还能从 images 补上
+	if err := d.saveArtwork(meta); err != nil {
+		slog.Warn("d1 artwork save failed", "source", meta.Source, "post_id", meta.PostID, "err", err)
+	}
+	return nil
+}
+
+// SaveMessage 记录一份副本所在的频道和消息，一张图分流/镜像到几个频道就有几行
+func (d *D1Client) SaveMessage(postID string, chatID int64, messageID, docMessageID int) error {
 	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
 		d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
-	
-	finalTags := fmt.Sprintf("%s %s", tags, source)
-	
-	sql := "INSERT OR IGNORE INTO images (id, file_name, origin_id, caption, artist, tags, created_at, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	params := []interface{}{postID, fileID, originID, caption, artist, finalTags, time.Now().Unix(), width, height}
-	
+
+	sql := "INSERT OR REPLACE INTO image_messages (image_id, chat_id, message_id, doc_message_id, created_at) VALUES (?, ?, ?, ?, ?)"
+	params := []interface{}{postID, chatID, messageID, docMessageID, time.Now().Unix()}
+
 	body := map[string]interface{}{
 		"sql":    sql,
 		"params": params,
@@ -104,10 +192,6 @@ func (d *D1Client) SaveImage(postID, fileID, originID, caption, artist, tags, so
 	if resp.IsError() {
 		return fmt.Errorf("D1 Error: %s", resp.String())
 	}
-
-	d.mu.Lock() // <--- 加写锁
-	d.History[postID] = true
-	d.mu.Unlock() // <--- 解写锁
 	return nil
 }
 
@@ -118,6 +202,7 @@ func (d *D1Client) CheckExists(postID string) bool {
 	d.mu.RUnlock() // <--- 解读锁
 	
 	if exists {
+		metrics.Count(metrics.SourceOf(postID), metrics.Duplicate)
 		return true
 	}
 
@@ -139,7 +224,7 @@ func (d *D1Client) CheckExists(postID string) bool {
 		Post(url)
 
 	if err != nil {
-		log.Printf("⚠️ D1 Check Error: %v", err)
+		slog.Warn("d1 check failed", "post_id", postID, "err", err)
 		// return false // “宁可发重，不可漏发”
 		// return true  // “宁可漏发，不可发重”
 		return false 
@@ -157,6 +242,7 @@ func (d *D1Client) CheckExists(postID string) bool {
 		d.mu.Lock() // <--- 加写锁 
 		d.History[postID] = true
 		d.mu.Unlock() // <--- 解写锁
+		metrics.Count(metrics.SourceOf(postID), metrics.Duplicate)
 		return true
 	}
 
@@ -191,6 +277,24 @@ func (d *D1Client) DeleteImage(postID string) error {
         return fmt.Errorf("D1 API Error: %s", resp.String())
     }
 
+    // 副本记录一起清掉，失败不影响主记录的删除
+    _, err = d.client.R().
+        SetHeader("Authorization", "Bearer "+d.cfg.CF_APIToken).
+        SetHeader("Content-Type", "application/json").
+        SetBody(map[string]interface{}{
+            "sql":    "DELETE FROM image_messages WHERE image_id = ?",
+            "params": []interface{}{postID},
+        }).
+        Post(url)
+    if err != nil {
+        slog.Warn("d1 delete image_messages failed", "post_id", postID, "err", err)
+    }
+
+    // 结构化数据：删掉这一页，作品没有剩余页时连同标签关联一起删
+    if err := d.deletePage(postID); err != nil {
+        slog.Warn("d1 delete page failed", "post_id", postID, "err", err)
+    }
+
 	d.mu.Lock() // <--- 加写锁
     delete(d.History, postID)
 	d.mu.Unlock() // <--- 解写锁
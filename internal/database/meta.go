@@ -0,0 +1,114 @@
+package database
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 标签类别，和 danbooru 的分类对应，其他站点一律 general
+const (
+	TagGeneral   = "general"
+	TagArtist    = "artist"
+	TagCharacter = "character"
+	TagCopyright = "copyright"
+	TagMeta      = "meta"
+)
+
+// Tag 一个完整的标签，Name 可以包含空格，不再用空格拼接后再拆
+type Tag struct {
+	Name string // 规范写法，入库前由 tagmap 填写
+	Raw  string // 来源站点的原始写法
+	Kind string
+}
+
+// ImageMeta 一页图片的全部元数据，SaveImage 按它写入 artworks / pages / tags
+type ImageMeta struct {
+	PostID    string // 单页 ID，如 pixiv_123_p0，也是去重用的 History key
+	ArtworkID string // 作品 ID，如 pixiv_123；为空时由 PostID 去掉 _pN 得到
+	PageIndex int
+	Source    string
+	SourceURL string
+	PageCount int // 作品总页数，0 表示不分页
+	Title     string
+	Caption   string // 纯文本说明，由 ProcessAndSend 按模板生成后入库
+	Note      string // 附加说明，如 kemono 未转存的附件
+	ArtistID  string
+	Artist    string
+	Rating    string
+	Tags      []Tag
+	Width     int
+	Height    int
+
+	// 发送后由 ProcessAndSend 填写
+	FileID   string
+	OriginID string
+}
+
+var pageSuffixRe = regexp.MustCompile(`_p(\d+)$`)
+
+// NewTags 按列表构造标签，列表里的每一项都是一个完整标签
+func NewTags(kind string, names ...string) []Tag {
+	var tags []Tag
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		tags = append(tags, Tag{Name: n, Raw: n, Kind: kind})
+	}
+	return tags
+}
+
+// SplitTags booru 系站点的 tag_string 本来就以空格分隔，直接拆开
+func SplitTags(kind, tagString string) []Tag {
+	return NewTags(kind, strings.Fields(tagString)...)
+}
+
+// Artwork 返回作品 ID 和页码，没有显式设置时从 PostID 推导
+func (m *ImageMeta) Artwork() (string, int) {
+	if m.ArtworkID != "" {
+		return m.ArtworkID, m.PageIndex
+	}
+	if sub := pageSuffixRe.FindStringSubmatch(m.PostID); sub != nil {
+		idx, _ := strconv.Atoi(sub[1])
+		return strings.TrimSuffix(m.PostID, sub[0]), idx
+	}
+	return m.PostID, m.PageIndex
+}
+
+// HasTag 按规范名判断，忽略大小写
+func (m *ImageMeta) HasTag(name string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag 不存在时追加一个标签
+func (m *ImageMeta) AddTag(name, kind string) {
+	if !m.HasTag(name) {
+		m.Tags = append(m.Tags, Tag{Name: name, Raw: name, Kind: kind})
+	}
+}
+
+// TagNames 规范标签列表
+func (m *ImageMeta) TagNames() []string {
+	names := make([]string, 0, len(m.Tags))
+	for _, t := range m.Tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// LegacyTags 兼容旧 images.tags 列 (前端按空格拆分搜索)，多词标签里的空格换成下划线
+func (m *ImageMeta) LegacyTags() string {
+	names := make([]string, 0, len(m.Tags)+1)
+	for _, t := range m.Tags {
+		names = append(names, strings.Join(strings.Fields(t.Name), "_"))
+	}
+	names = append(names, m.Source)
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SaveReview 保存一条待审内容，meta 里已经带上审核群里的 file_id
+func (d *D1Client) SaveReview(messageID int, meta ImageMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	_, err = d.Query("INSERT OR REPLACE INTO review_queue (message_id, post_id, meta, created_at) VALUES (?, ?, ?, ?)",
+		messageID, meta.PostID, string(data), time.Now().Unix())
+	return err
+}
+
+// GetReview 按审核消息 ID 取回待审内容，不存在时返回 nil
+func (d *D1Client) GetReview(messageID int) (*ImageMeta, error) {
+	rows, err := d.Query("SELECT meta FROM review_queue WHERE message_id = ?", messageID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	raw, _ := rows[0]["meta"].(string)
+
+	var meta ImageMeta
+	if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (d *D1Client) DeleteReview(messageID int) error {
+	_, err := d.Query("DELETE FROM review_queue WHERE message_id = ?", messageID)
+	return err
+}
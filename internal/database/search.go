@@ -0,0 +1,81 @@
+package database
+
+import (
+	"strings"
+
+	"my-bot-go/internal/rating"
+)
+
+// SearchQuery 图库搜索条件，内联查询和私聊里的 /search /random 等指令共用
+type SearchQuery struct {
+	Terms      []string // 每个词都要匹配 ID 前缀、作者或标签之一
+	Artist     string   // 只按作者名匹配
+	IncludeR18 bool
+	Random     bool // 随机排序，否则按发布时间倒序
+	Limit      int
+	Offset     int
+}
+
+// SearchResult 搜索结果里用得到的字段
+type SearchResult struct {
+	PostID    string
+	FileID    string
+	OriginID  string
+	Caption   string
+	Artist    string
+	SourceURL string
+}
+
+// 每个关键词占 4 个参数，受 D1 参数上限限制
+const maxSearchTerms = 20
+
+// SearchImages 按条件查图，只返回有图片 file_id 的记录，以文件形式转发的预览没法作为图片发出
+func (d *D1Client) SearchImages(q SearchQuery) ([]SearchResult, error) {
+	terms := q.Terms
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	like := strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`)
+
+	where := []string{"i.file_name IS NOT NULL", "i.file_name != ''", "i.file_name != IFNULL(i.origin_id, '')"}
+	var params []interface{}
+	for _, t := range terms {
+		t = like.Replace(t)
+		where = append(where, `(i.id LIKE ? ESCAPE '\' OR i.artist LIKE ? ESCAPE '\' OR (' ' || i.tags || ' ') LIKE ? ESCAPE '\' OR (' ' || IFNULL(i.raw_tags, '') || ' ') LIKE ? ESCAPE '\')`)
+		params = append(params, t+"%", "%"+t+"%", "% "+t+" %", "% "+t+" %")
+	}
+	if q.Artist != "" {
+		where = append(where, `i.artist LIKE ? ESCAPE '\'`)
+		params = append(params, "%"+like.Replace(q.Artist)+"%")
+	}
+	if !q.IncludeR18 {
+		where = append(where, `IFNULL(i.rating, '') NOT IN (?, ?)`, `(' ' || IFNULL(i.tags, '') || ' ') NOT LIKE ?`)
+		params = append(params, rating.Questionable, rating.Explicit, "% "+rating.R18Tag+" %")
+	}
+
+	order := "i.created_at DESC"
+	if q.Random {
+		order = "RANDOM()"
+	}
+	params = append(params, q.Limit, q.Offset)
+
+	rows, err := d.Query(`SELECT i.id, i.file_name, i.origin_id, i.caption, i.artist, a.source_url
+		FROM images i LEFT JOIN pages p ON p.id = i.id LEFT JOIN artworks a ON a.id = p.artwork_id
+		WHERE `+strings.Join(where, " AND ")+" ORDER BY "+order+" LIMIT ? OFFSET ?", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		r := SearchResult{}
+		r.PostID, _ = row["id"].(string)
+		r.FileID, _ = row["file_name"].(string)
+		r.OriginID, _ = row["origin_id"].(string)
+		r.Caption, _ = row["caption"].(string)
+		r.Artist, _ = row["artist"].(string)
+		r.SourceURL, _ = row["source_url"].(string)
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -0,0 +1,23 @@
+package database
+
+import "time"
+
+// GetState 读取爬虫进度，没有记录时返回空串
+func (d *D1Client) GetState(name string) (string, error) {
+	rows, err := d.Query("SELECT value FROM crawler_state WHERE name = ?", name)
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	value, _ := rows[0]["value"].(string)
+	return value, nil
+}
+
+// SetState 保存爬虫进度，演练时不写
+func (d *D1Client) SetState(name, value string) error {
+	if d.dryRun || d.cfg.DryRunFor("all") {
+		return nil
+	}
+	_, err := d.Query("INSERT OR REPLACE INTO crawler_state (name, value, updated_at) VALUES (?, ?, ?)",
+		name, value, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ImageMessage 一份副本所在的频道和消息
+type ImageMessage struct {
+	ChatID       int64
+	MessageID    int
+	DocMessageID int
+}
+
+// Tombstone 软删除时保存的完整元数据和副本位置
+// 标题、来源链接、画师 ID 和标签类型都在 Meta 里，恢复时原样写回
+type Tombstone struct {
+	PostID    string
+	Meta      ImageMeta
+	Messages  []ImageMessage
+	DeletedAt int64
+}
+
+// Messages 查一张图在各个频道的消息
+func (d *D1Client) Messages(postID string) ([]ImageMessage, error) {
+	rows, err := d.Query("SELECT chat_id, message_id, doc_message_id FROM image_messages WHERE image_id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []ImageMessage
+	for _, row := range rows {
+		chatID, _ := row["chat_id"].(float64)
+		msgID, _ := row["message_id"].(float64)
+		docID, _ := row["doc_message_id"].(float64)
+		msgs = append(msgs, ImageMessage{ChatID: int64(chatID), MessageID: int(msgID), DocMessageID: int(docID)})
+	}
+	return msgs, nil
+}
+
+// FindByMessage 按频道消息反查图片 ID，预览图和原图消息都能查
+func (d *D1Client) FindByMessage(chatID int64, messageID int) (string, error) {
+	rows, err := d.Query("SELECT image_id FROM image_messages WHERE chat_id = ? AND (message_id = ? OR doc_message_id = ?) LIMIT 1",
+		chatID, messageID, messageID)
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	id, _ := rows[0]["image_id"].(string)
+	return id, nil
+}
+
+// FindByPrefix 按前缀查图片 ID，例如 pixiv_123_ 查出这个作品的所有页
+func (d *D1Client) FindByPrefix(prefix string, limit int) ([]string, error) {
+	// _ 和 % 在 LIKE 里是通配符，要转义
+	escaped := strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`).Replace(prefix)
+	rows, err := d.Query(`SELECT id FROM images WHERE id LIKE ? ESCAPE '\' ORDER BY id LIMIT ?`, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, row := range rows {
+		if id, ok := row["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SoftDelete 先把 LoadImage 读出的元数据和副本位置存进 deleted_images，再删除
+func (d *D1Client) SoftDelete(postID string) (*Tombstone, error) {
+	meta, err := d.LoadImage(postID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := d.Messages(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tombstone{PostID: postID, Meta: *meta, Messages: msgs, DeletedAt: time.Now().Unix()}
+	data, _ := json.Marshal(t.Meta)
+	msgData, _ := json.Marshal(t.Messages)
+	if _, err := d.Query("INSERT OR REPLACE INTO deleted_images (id, data, messages, deleted_at) VALUES (?, ?, ?, ?)",
+		postID, string(data), string(msgData), t.DeletedAt); err != nil {
+		return nil, err
+	}
+	return t, d.DeleteImage(postID)
+}
+
+// Undelete 恢复保留期内的软删除记录，副本消息已经删掉了，由调用方重新发送
+func (d *D1Client) Undelete(postID string, window time.Duration) (*Tombstone, error) {
+	rows, err := d.Query("SELECT data, messages, deleted_at FROM deleted_images WHERE id = ? AND deleted_at >= ?",
+		postID, time.Now().Add(-window).Unix())
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s not in trash or expired", postID)
+	}
+
+	t := &Tombstone{PostID: postID}
+	data, _ := rows[0]["data"].(string)
+	msgData, _ := rows[0]["messages"].(string)
+	deletedAt, _ := rows[0]["deleted_at"].(float64)
+	t.DeletedAt = int64(deletedAt)
+	if err := json.Unmarshal([]byte(data), &t.Meta); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(msgData), &t.Messages)
+
+	// 旧的墓碑存的是 images 行，解不出 PostID，按旧格式还原
+	if t.Meta.PostID == "" {
+		var row map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &row); err != nil {
+			return nil, err
+		}
+		t.Meta = legacyMeta(row)
+	}
+
+	// SaveImage 会写 images、artworks、pages、artwork_tags 并标记 History
+	if err := d.SaveImage(t.Meta); err != nil {
+		return nil, err
+	}
+	if _, err := d.Query("DELETE FROM deleted_images WHERE id = ?", postID); err != nil {
+		slog.Warn("d1 delete tombstone failed", "post_id", postID, "err", err)
+	}
+	return t, nil
+}
+
+// PurgeDeleted 清理超过保留期的软删除记录
+func (d *D1Client) PurgeDeleted(window time.Duration) error {
+	_, err := d.Query("DELETE FROM deleted_images WHERE deleted_at < ?", time.Now().Add(-window).Unix())
+	return err
+}
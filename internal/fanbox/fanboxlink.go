@@ -1,20 +1,37 @@
 package fanbox
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"time"
+
+	_ "golang.org/x/image/webp"
 )
 
+// ErrRestricted 帖子需要更高档位的赞助才能查看
+var ErrRestricted = errors.New("fanbox post is restricted")
+
 // FanboxPost 结构
 type FanboxPost struct {
-	ID      string
-	Title   string
-	Images  []FanboxImage
-	Tags    []string
-	Author  string
+	ID          string
+	Title       string
+	Images      []FanboxImage
+	Tags        []string
+	Author      string
+	CreatorID   string
+	Adult       bool
+	Restricted  bool
+	FeeRequired int // 解锁所需的月费档位 (日元)
 }
 
 // FanboxImage 图片信息
@@ -24,67 +41,193 @@ type FanboxImage struct {
 	Height int
 }
 
+type fanboxImageResp struct {
+	ID          string `json:"id"`
+	Extension   string `json:"extension"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	OriginalURL string `json:"originalUrl"`
+}
+
+type fanboxPostResp struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Tags            []string `json:"tags"`
+	CreatorID       string   `json:"creatorId"`
+	FeeRequired     int      `json:"feeRequired"`
+	IsRestricted    bool     `json:"isRestricted"`
+	HasAdultContent bool     `json:"hasAdultContent"`
+	User            struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	// 未解锁时 body 为 null
+	Body *struct {
+		// type=image 的帖子
+		Images []fanboxImageResp `json:"images"`
+		// type=article 的帖子，图片按 blocks 顺序排列
+		Blocks []struct {
+			Type    string `json:"type"`
+			ImageID string `json:"imageId"`
+		} `json:"blocks"`
+		ImageMap map[string]fanboxImageResp `json:"imageMap"`
+	} `json:"body"`
+}
+
+// FanboxPostSummary 创作者帖子列表中的单条
+type FanboxPostSummary struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	FeeRequired  int    `json:"feeRequired"`
+	IsRestricted bool   `json:"isRestricted"`
+}
+
+func newRequest(apiURL, cookie string) *http.Request {
+	req, _ := http.NewRequest("GET", apiURL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Cookie", cookie) // 需要 Fanbox Cookie (FANBOXSESSID=...)
+	req.Header.Set("Origin", "https://www.fanbox.cc")
+	req.Header.Set("Referer", "https://www.fanbox.cc/")
+	return req
+}
+
+// PostLinkRe 匹配 fanbox 帖子链接，第一个分组是帖子 ID
+var PostLinkRe = regexp.MustCompile(`fanbox\.cc/(?:@[\w-]+/)?posts/(\d+)`)
+
+// ParsePostID 从 fanbox 链接中提取帖子 ID
+// 支持 https://www.fanbox.cc/@creator/posts/123 与 https://creator.fanbox.cc/posts/123
+func ParsePostID(link string) (string, error) {
+	matches := PostLinkRe.FindStringSubmatch(link)
+	if len(matches) < 2 {
+		return "", fmt.Errorf("invalid fanbox url")
+	}
+	return matches[1], nil
+}
+
 // GetFanboxPost 获取 Fanbox 帖子详情
+// 未解锁的帖子会返回 Restricted=true 的 post 和 ErrRestricted，调用方可据此提示档位
 func GetFanboxPost(postID string, cookie string) (*FanboxPost, error) {
 	client := &http.Client{Timeout: 30 * time.Second}
 
 	// Fanbox API: https://api.fanbox.cc/post.info?postId=1234567890
-	url := fmt.Sprintf("https://api.fanbox.cc/post.info?postId=%s", postID)
-	
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Cookie", cookie) // 需要 Fanbox Cookie
-	req.Header.Set("Origin", "https://*.fanbox.cc")
+	apiURL := fmt.Sprintf("https://api.fanbox.cc/post.info?postId=%s", postID)
 
-	resp, err := client.Do(req)
+	resp, err := client.Do(newRequest(apiURL, cookie))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("API status code: %d", resp.StatusCode)
+	}
+
 	var apiResp struct {
-		Body struct {
-			Title      string   `json:"title"`
-			Images     []struct {
-				Extension string `json:"extension"`
-				Path      string `json:"path"`
-			} `json:"images"`
-			Tags  []string `json:"tags"`
-			Creator struct {
-				Name string `json:"name"`
-			} `json:"creator"`
-		} `json:"body"`
-	}
-	
+		Body fanboxPostResp `json:"body"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, err
 	}
 
+	body := apiResp.Body
 	post := &FanboxPost{
-		ID:     postID,
-		Title:  apiResp.Body.Title,
-		Author: apiResp.Body.Creator.Name,
-		Tags:   apiResp.Body.Tags,
+		ID:          postID,
+		Title:       body.Title,
+		Author:      body.User.Name,
+		CreatorID:   body.CreatorID,
+		Tags:        body.Tags,
+		Adult:       body.HasAdultContent,
+		Restricted:  body.IsRestricted || body.Body == nil,
+		FeeRequired: body.FeeRequired,
+	}
+
+	if post.Restricted {
+		return post, ErrRestricted
 	}
 
-	// 解析图片 URL
-	for _, img := range apiResp.Body.Images {
-		post.Images = append(post.Images, FanboxImage{
-			URL:    fmt.Sprintf("https://storage.fanbox.cc/%s.%s", img.Path, img.Extension),
-			Width:  0,  // Fanbox API 不提供，需要下载后获取或估算
-			Height: 0,
-		})
+	// 优先用 API 给出的 originalUrl，宽高为 0 的等下载后再解码
+	toImage := func(img fanboxImageResp) FanboxImage {
+		return FanboxImage{URL: img.OriginalURL, Width: img.Width, Height: img.Height}
+	}
+
+	for _, img := range body.Body.Images {
+		post.Images = append(post.Images, toImage(img))
+	}
+	for _, block := range body.Body.Blocks {
+		if block.Type != "image" {
+			continue
+		}
+		if img, ok := body.Body.ImageMap[block.ImageID]; ok {
+			post.Images = append(post.Images, toImage(img))
+		}
 	}
 
 	return post, nil
 }
 
+// ListCreatorPosts 获取创作者最新一页的帖子列表
+func ListCreatorPosts(creatorID, cookie string) ([]FanboxPostSummary, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	// 先拿分页 URL 列表，第一页就是最新的帖子
+	pagURL := fmt.Sprintf("https://api.fanbox.cc/post.paginateCreator?creatorId=%s", url.QueryEscape(creatorID))
+	resp, err := client.Do(newRequest(pagURL, cookie))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("API status code: %d", resp.StatusCode)
+	}
+
+	var pages struct {
+		Body []string `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pages); err != nil {
+		return nil, err
+	}
+	if len(pages.Body) == 0 {
+		return nil, nil
+	}
+
+	listResp, err := client.Do(newRequest(pages.Body[0], cookie))
+	if err != nil {
+		return nil, err
+	}
+	defer listResp.Body.Close()
+
+	if listResp.StatusCode != 200 {
+		return nil, fmt.Errorf("API status code: %d", listResp.StatusCode)
+	}
+
+	var list struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.NewDecoder(listResp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	// 新接口 body 直接是数组，旧接口是 {items, nextUrl}
+	var items []FanboxPostSummary
+	if err := json.Unmarshal(list.Body, &items); err != nil {
+		var old struct {
+			Items []FanboxPostSummary `json:"items"`
+		}
+		if err := json.Unmarshal(list.Body, &old); err != nil {
+			return nil, err
+		}
+		items = old.Items
+	}
+
+	return items, nil
+}
+
 // DownloadFanboxImage 下载图片
 func DownloadFanboxImage(url, cookie string) ([]byte, error) {
 	client := &http.Client{Timeout: 60 * time.Second}
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("User-Agent", "Mozilla/5.0")
-	req.Header.Set("Referer", "https://*.fanbox.cc/")
+	req.Header.Set("Referer", "https://www.fanbox.cc/")
 	req.Header.Set("Cookie", cookie)
 
 	resp, err := client.Do(req)
@@ -93,5 +236,20 @@ func DownloadFanboxImage(url, cookie string) ([]byte, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download status %d", resp.StatusCode)
+	}
+
 	return io.ReadAll(resp.Body)
 }
+
+// DecodeSize 在 API 没给宽高时，从图片数据里解码宽高
+func DecodeSize(img FanboxImage, data []byte) (int, int) {
+	if img.Width > 0 && img.Height > 0 {
+		return img.Width, img.Height
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return cfg.Width, cfg.Height
+	}
+	return 0, 0
+}
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/metrics"
+)
+
+// Meta 下载前就能拿到的作品信息，拿不到的字段留空即可，对应的条件会被跳过
+type Meta struct {
+	Source string
+	ID     string // 只用于日志
+	Tags   []string
+	Artist string
+	Width  int
+	Height int
+}
+
+// Filter 按 FILTER_* 配置在下载前过滤作品，并统计每种原因拦下了多少
+type Filter struct {
+	global  config.ContentFilter
+	sources map[string]config.ContentFilter
+
+	mu      sync.Mutex
+	checked int
+	reasons map[string]int
+}
+
+func New(cfg *config.Config) *Filter {
+	return &Filter{
+		global:  cfg.Filter,
+		sources: cfg.SourceFilters,
+		reasons: make(map[string]int),
+	}
+}
+
+// Allow 返回 true 表示可以下载；被拦下时记录原因并打日志
+func (f *Filter) Allow(m Meta) bool {
+	if f == nil {
+		return true
+	}
+
+	reason := check(f.global, m)
+	if reason == "" {
+		if sf, ok := f.sources[strings.ToLower(m.Source)]; ok {
+			reason = check(sf, m)
+		}
+	}
+
+	f.mu.Lock()
+	f.checked++
+	if reason != "" {
+		f.reasons[reason]++
+	}
+	f.mu.Unlock()
+
+	if reason != "" {
+		metrics.Count(m.Source, metrics.Filtered)
+		slog.Info("filtered", "source", m.Source, "post_id", m.ID, "reason", reason)
+		return false
+	}
+	return true
+}
+
+// Stats 汇总过滤结果，拦截原因按次数从多到少排列
+func (f *Filter) Stats() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	blocked := 0
+	keys := make([]string, 0, len(f.reasons))
+	for k, v := range f.reasons {
+		keys = append(keys, k)
+		blocked += v
+	}
+	sort.Slice(keys, func(i, j int) bool { return f.reasons[keys[i]] > f.reasons[keys[j]] })
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Checked: %d, Blocked: %d", f.checked, blocked)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "\n%d × %s", f.reasons[k], k)
+	}
+	return sb.String()
+}
+
+// check 返回拦截原因，空字符串表示通过
+func check(c config.ContentFilter, m Meta) string {
+	for _, a := range c.BlockArtists {
+		if m.Artist != "" && strings.EqualFold(a, m.Artist) {
+			return "artist:" + a
+		}
+	}
+
+	tagSet := make(map[string]bool, len(m.Tags))
+	for _, t := range m.Tags {
+		tagSet[normalizeTag(t)] = true
+	}
+	for _, t := range c.ExcludeTags {
+		if tagSet[normalizeTag(t)] {
+			return "exclude:" + t
+		}
+	}
+	if len(c.IncludeTags) > 0 {
+		hit := false
+		for _, t := range c.IncludeTags {
+			if tagSet[normalizeTag(t)] {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return "include:none"
+		}
+	}
+
+	// 宽高未知时不做尺寸判断，交给下载后的流程
+	if m.Width <= 0 || m.Height <= 0 {
+		return ""
+	}
+	if c.MinWidth > 0 && m.Width < c.MinWidth {
+		return fmt.Sprintf("width<%d", c.MinWidth)
+	}
+	if c.MinHeight > 0 && m.Height < c.MinHeight {
+		return fmt.Sprintf("height<%d", c.MinHeight)
+	}
+	ratio := float64(m.Width) / float64(m.Height)
+	if c.MinRatio > 0 && ratio < c.MinRatio {
+		return fmt.Sprintf("ratio<%.2f", c.MinRatio)
+	}
+	if c.MaxRatio > 0 && ratio > c.MaxRatio {
+		return fmt.Sprintf("ratio>%.2f", c.MaxRatio)
+	}
+	return ""
+}
+
+// normalizeTag 各站点的写法不一样：ai_generated / AI-generated / #AI生成
+func normalizeTag(t string) string {
+	t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+	return strings.NewReplacer("_", "-", " ", "-").Replace(t)
+}
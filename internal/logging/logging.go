@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup 按 LOG_LEVEL / LOG_FORMAT 设置全局 slog，标准库 log 的输出也会转到这里
+// level: debug / info / warn / error，format: text / json
+func Setup(level, format string) {
+	slog.SetDefault(slog.New(newHandler(os.Stderr, level, format)))
+}
+
+func newHandler(w io.Writer, level, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// ParseLevel 不认识的级别按 info 处理
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Source 带 source 属性的 logger，爬虫和链接处理用
+func Source(name string) *slog.Logger {
+	return slog.Default().With("source", name)
+}
+
+// Post 带 source 和 post_id 属性的 logger
+func Post(source, postID string) *slog.Logger {
+	return slog.Default().With("source", source, "post_id", postID)
+}
+
+// Fatal 记一条 error 然后退出
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 	"regexp"
-	"strings"
 )
 
 // ArtworkInfo 存储从 ManyACG 爬取的结构化信息
@@ -102,24 +101,3 @@ func DownloadOriginal(ctx context.Context, pictureID string) ([]byte, error) {
 
 	return io.ReadAll(resp.Body)
 }
-
-// FormatTags 将标签数组转换为 #tag 字符串，并去重
-func FormatTags(tags []string) string {
-	seen := make(map[string]bool)
-	var sb strings.Builder
-	for _, tag := range tags {
-		tag = strings.TrimSpace(tag)
-		if tag == "" {
-			continue
-		}
-		tag = strings.ReplaceAll(tag, " ", "_")
-		
-		if !seen[tag] {
-			sb.WriteString("#")
-			sb.WriteString(tag)
-			sb.WriteString(" ")
-			seen[tag] = true
-		}
-	}
-	return strings.TrimSpace(sb.String())
-}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 心跳多久没成功算 Telegram 不可用，D1 最后一次失败后多久还没恢复算不可用
+const (
+	telegramTimeout = 5 * time.Minute
+	d1Timeout       = 10 * time.Minute
+)
+
+// histogram Prometheus 风格的累计分布
+type histogram struct {
+	bounds []float64
+	counts []int // 每个桶自己的次数，输出时再累加
+	sum    float64
+	count  int
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(sb *strings.Builder, name, help string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	cum := 0
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		fmt.Fprintf(sb, "%s_bucket{le=\"%g\"} %d\n", name, b, cum)
+	}
+	fmt.Fprintf(sb, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, h.count, name, h.sum, name, h.count)
+}
+
+var kindNames = [numKinds]string{"fetched", "duplicate", "filtered", "sent", "failed"}
+
+// Health /healthz 的判断：Telegram 在拉取且心跳正常，D1 没有持续失败
+func (r *Registry) Health() (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	ok := true
+	var lines []string
+
+	switch {
+	case !r.polling:
+		ok = false
+		lines = append(lines, "telegram: not polling")
+	case r.telegramOK.IsZero() || now.Sub(r.telegramOK) > telegramTimeout:
+		ok = false
+		lines = append(lines, "telegram: no heartbeat since "+formatTime(r.telegramOK))
+	default:
+		lines = append(lines, "telegram: ok, last heartbeat "+formatTime(r.telegramOK))
+	}
+
+	// 只看最近一次请求是不是失败，闲着没有请求不算不健康
+	if r.d1Failed.After(r.d1OK) && now.Sub(r.d1OK) > d1Timeout {
+		ok = false
+		lines = append(lines, "d1: failing, last success "+formatTime(r.d1OK))
+	} else {
+		lines = append(lines, "d1: ok, last success "+formatTime(r.d1OK))
+	}
+	return ok, strings.Join(lines, "\n")
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Prometheus 文本格式
+func (r *Registry) Prometheus() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("# HELP mtcacg_source_events_total Images per source by outcome.\n# TYPE mtcacg_source_events_total counter\n")
+	for _, name := range sortedKeys(r.sources) {
+		for k, kind := range kindNames {
+			fmt.Fprintf(&sb, "mtcacg_source_events_total{source=%q,kind=%q} %d\n", name, kind, r.sources[name][k])
+		}
+	}
+
+	sb.WriteString("# HELP mtcacg_crawler_cycles_total Finished crawler cycles.\n# TYPE mtcacg_crawler_cycles_total counter\n")
+	for _, name := range sortedKeys(r.cycles) {
+		fmt.Fprintf(&sb, "mtcacg_crawler_cycles_total{crawler=%q} %d\n", name, r.cycles[name])
+	}
+	sb.WriteString("# HELP mtcacg_crawler_last_run_timestamp_seconds When the crawler last finished a cycle.\n# TYPE mtcacg_crawler_last_run_timestamp_seconds gauge\n")
+	for _, name := range sortedKeys(r.lastRun) {
+		fmt.Fprintf(&sb, "mtcacg_crawler_last_run_timestamp_seconds{crawler=%q} %d\n", name, r.lastRun[name].Unix())
+	}
+	sb.WriteString("# HELP mtcacg_crawler_next_run_timestamp_seconds When the crawler starts its next cycle.\n# TYPE mtcacg_crawler_next_run_timestamp_seconds gauge\n")
+	for _, name := range sortedKeys(r.nextRun) {
+		fmt.Fprintf(&sb, "mtcacg_crawler_next_run_timestamp_seconds{crawler=%q} %d\n", name, r.nextRun[name].Unix())
+	}
+
+	fmt.Fprintf(&sb, "# HELP mtcacg_d1_requests_total D1 API requests.\n# TYPE mtcacg_d1_requests_total counter\nmtcacg_d1_requests_total %d\n", r.d1Requests)
+	fmt.Fprintf(&sb, "# HELP mtcacg_d1_errors_total Failed D1 API requests.\n# TYPE mtcacg_d1_errors_total counter\nmtcacg_d1_errors_total %d\n", r.d1Errors)
+	r.d1Hist.write(&sb, "mtcacg_d1_request_duration_seconds", "D1 API request latency.")
+	r.sendHist.write(&sb, "mtcacg_telegram_send_duration_seconds", "Telegram photo upload latency.")
+	r.downloadHist.write(&sb, "mtcacg_download_bytes", "Size of downloaded images.")
+
+	fmt.Fprintf(&sb, "# HELP mtcacg_uptime_seconds Seconds since start.\n# TYPE mtcacg_uptime_seconds gauge\nmtcacg_uptime_seconds %d\n", int(time.Since(r.started).Seconds()))
+	return sb.String()
+}
+
+// Serve 在 addr 上提供 /healthz、/readyz 和 /metrics，ctx 结束时关闭
+func Serve(ctx context.Context, addr string, historySize func() int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		ok, detail := std.Health()
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, detail)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		std.mu.Lock()
+		ready := std.ready
+		std.mu.Unlock()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "starting")
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, std.Prometheus())
+		fmt.Fprintf(w, "# HELP mtcacg_history_size IDs in the in-memory history.\n# TYPE mtcacg_history_size gauge\nmtcacg_history_size %d\n", historySize())
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	slog.Info("metrics listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("metrics server failed", "err", err)
+	}
+}
@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind 每个来源统计的计数类型
+type Kind int
+
+const (
+	Fetched   Kind = iota // 下载完交给 ProcessAndSend
+	Duplicate             // 已经发过，按 ID 前缀归到来源
+	Filtered              // 被 FILTER_* 拦下
+	Sent                  // 发送并入库成功
+	Failed                // 发送或入库失败
+	numKinds
+)
+
+// Registry 进程内的运行统计，重启后清零
+type Registry struct {
+	mu      sync.Mutex
+	started time.Time
+	sources map[string]*[numKinds]int
+	lastRun map[string]time.Time // 爬虫上一轮跑完的时间
+	nextRun map[string]time.Time // 爬虫下一轮开始的时间
+	cycles  map[string]int       // 爬虫跑完的轮数
+
+	d1Requests int
+	d1Errors   int
+	d1OK       time.Time // 最近一次成功的 D1 请求
+	d1Failed   time.Time // 最近一次失败的 D1 请求
+
+	sends    int
+	sendSum  time.Duration
+	sendMax  time.Duration
+	sendLast time.Duration
+
+	// 给 /metrics 用的分布，单位是秒和字节
+	sendHist     *histogram
+	d1Hist       *histogram
+	downloadHist *histogram
+
+	telegramOK time.Time // 最近一次 Telegram 心跳成功
+	polling    bool      // 正在拉取更新
+	ready      bool      // 迁移、History 同步完成，Bot 开始工作
+}
+
+func New() *Registry {
+	return &Registry{
+		started: time.Now(),
+		sources: make(map[string]*[numKinds]int),
+		lastRun: make(map[string]time.Time),
+		nextRun: make(map[string]time.Time),
+		cycles:  make(map[string]int),
+
+		sendHist:     newHistogram(0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+		d1Hist:       newHistogram(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+		downloadHist: newHistogram(256<<10, 1<<20, 4<<20, 8<<20, 16<<20, 32<<20),
+	}
+}
+
+// std 爬虫、D1 和 Bot 共用的全局统计，通过下面的包级函数访问
+var std = New()
+
+// Count 来源的某项计数加一，来源名不区分大小写
+func Count(source string, k Kind) {
+	source = strings.ToLower(source)
+	if source == "" {
+		source = "unknown"
+	}
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	c, ok := std.sources[source]
+	if !ok {
+		c = new([numKinds]int)
+		std.sources[source] = c
+	}
+	c[k]++
+}
+
+// SourceOf 从图片 ID 取来源前缀，如 yande_123_p0 -> yande
+func SourceOf(postID string) string {
+	source, _, _ := strings.Cut(postID, "_")
+	return source
+}
+
+// Scheduled 记录爬虫多久之后开始下一轮 (启动时的错峰等待)
+func Scheduled(crawler string, in time.Duration) {
+	std.mu.Lock()
+	std.nextRun[crawler] = time.Now().Add(in)
+	std.mu.Unlock()
+}
+
+// RunDone 爬虫一轮跑完，接下来休眠 next
+func RunDone(crawler string, next time.Duration) {
+	now := time.Now()
+	std.mu.Lock()
+	std.lastRun[crawler] = now
+	std.nextRun[crawler] = now.Add(next)
+	std.cycles[crawler]++
+	std.mu.Unlock()
+}
+
+// D1Request 记录一次 D1 请求，failed 为网络错误或 API 返回错误，网络错误时 took 为 0
+func D1Request(failed bool, took time.Duration) {
+	now := time.Now()
+	std.mu.Lock()
+	std.d1Requests++
+	if failed {
+		std.d1Errors++
+		std.d1Failed = now
+	} else {
+		std.d1OK = now
+	}
+	if took > 0 {
+		std.d1Hist.observe(took.Seconds())
+	}
+	std.mu.Unlock()
+}
+
+// Downloaded 记录一次下载的大小
+func Downloaded(bytes int) {
+	std.mu.Lock()
+	std.downloadHist.observe(float64(bytes))
+	std.mu.Unlock()
+}
+
+// SendLatency 记录一次上传图片到 Telegram 的耗时
+func SendLatency(d time.Duration) {
+	std.mu.Lock()
+	std.sends++
+	std.sendSum += d
+	std.sendLast = d
+	if d > std.sendMax {
+		std.sendMax = d
+	}
+	std.sendHist.observe(d.Seconds())
+	std.mu.Unlock()
+}
+
+// TelegramOK Telegram 心跳成功
+func TelegramOK() {
+	std.mu.Lock()
+	std.telegramOK = time.Now()
+	std.mu.Unlock()
+}
+
+// SetPolling 标记是否正在拉取 Telegram 更新
+func SetPolling(on bool) {
+	std.mu.Lock()
+	std.polling = on
+	std.mu.Unlock()
+}
+
+// SetReady 启动流程走完后标记为就绪
+func SetReady(ready bool) {
+	std.mu.Lock()
+	std.ready = ready
+	std.mu.Unlock()
+}
+
+// Report 生成 /stats 的文字报告，History 大小由调用方传入
+func Report(historySize int) string {
+	return std.Report(historySize)
+}
+
+func (r *Registry) Report(historySize int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⏱ Uptime: %s\n", now.Sub(r.started).Round(time.Second))
+	fmt.Fprintf(&sb, "🧠 History: %d\n", historySize)
+
+	d1Rate := 0.0
+	if r.d1Requests > 0 {
+		d1Rate = float64(r.d1Errors) * 100 / float64(r.d1Requests)
+	}
+	fmt.Fprintf(&sb, "🗄 D1: %d requests, %d errors (%.1f%%)\n", r.d1Requests, r.d1Errors, d1Rate)
+
+	if r.sends > 0 {
+		avg := r.sendSum / time.Duration(r.sends)
+		fmt.Fprintf(&sb, "📤 Telegram send: avg %s, max %s, last %s (%d uploads)\n",
+			avg.Round(time.Millisecond), r.sendMax.Round(time.Millisecond), r.sendLast.Round(time.Millisecond), r.sends)
+	} else {
+		sb.WriteString("📤 Telegram send: no uploads yet\n")
+	}
+
+	sb.WriteString("\n📊 Sources (fetched / dup / filtered / sent / failed)\n")
+	if len(r.sources) == 0 {
+		sb.WriteString("(none yet)\n")
+	}
+	for _, name := range sortedKeys(r.sources) {
+		c := r.sources[name]
+		fmt.Fprintf(&sb, "%s: %d / %d / %d / %d / %d\n", name, c[Fetched], c[Duplicate], c[Filtered], c[Sent], c[Failed])
+	}
+
+	sb.WriteString("\n🕒 Crawlers (last run → next run)\n")
+	if len(r.nextRun) == 0 {
+		sb.WriteString("(none scheduled)\n")
+	}
+	for _, name := range sortedKeys(r.nextRun) {
+		last := "never"
+		if t, ok := r.lastRun[name]; ok {
+			last = t.Format("01-02 15:04")
+		}
+		next := "running"
+		if t := r.nextRun[name]; t.After(now) {
+			next = t.Format("01-02 15:04") + " (in " + t.Sub(now).Round(time.Minute).String() + ")"
+		}
+		fmt.Fprintf(&sb, "%s: %s → %s\n", name, last, next)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
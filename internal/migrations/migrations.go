@@ -0,0 +1,142 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// DB 能执行 SQL 的后端，D1Client 实现了它，本地后端也只需要实现这一个方法
+type DB interface {
+	Query(sql string, params ...interface{}) ([]map[string]interface{}, error)
+}
+
+// Migration 一个版本化的 SQL 文件，文件名格式 0001_name.sql
+type Migration struct {
+	Version   string
+	Name      string
+	SQL       string
+	AppliedAt int64 // 0 表示还没执行
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version TEXT PRIMARY KEY,
+  name TEXT,
+  applied_at INTEGER
+)`
+
+// All 按版本号顺序返回内嵌的全部迁移
+func All() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Migration
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		version, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name: %s", e.Name())
+		}
+		data, err := files.ReadFile(path.Join("sql", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Status 返回全部迁移及其执行时间
+func Status(db DB) ([]Migration, error) {
+	list, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Query(createTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]int64)
+	for _, row := range rows {
+		v, _ := row["version"].(string)
+		at, _ := row["applied_at"].(float64)
+		applied[v] = int64(at)
+	}
+	for i := range list {
+		list[i].AppliedAt = applied[list[i].Version]
+	}
+	return list, nil
+}
+
+// Up 依次执行还没执行过的迁移，返回本次执行的版本
+func Up(db DB) ([]string, error) {
+	list, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, m := range list {
+		if m.AppliedAt != 0 {
+			continue
+		}
+		for _, stmt := range statements(m.SQL) {
+			if _, err := db.Query(stmt); err != nil {
+				// 老库是照 README 手动建的表，列和表可能早就存在
+				if alreadyApplied(err) {
+					slog.Info("migration already applied", "version", m.Version, "name", m.Name, "err", err)
+					continue
+				}
+				return done, fmt.Errorf("migration %s_%s: %w", m.Version, m.Name, err)
+			}
+		}
+		if _, err := db.Query("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().Unix()); err != nil {
+			return done, err
+		}
+		slog.Info("migration applied", "version", m.Version, "name", m.Name)
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// statements 按行尾分号拆分语句，去掉 -- 注释
+func statements(sql string) []string {
+	var out []string
+	var sb strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			out = append(out, strings.TrimSuffix(strings.TrimSpace(sb.String()), ";"))
+			sb.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(sb.String()); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+func alreadyApplied(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate column name") || strings.Contains(msg, "already exists")
+}
@@ -0,0 +1,11 @@
+-- 最早的图片表，前端 (web-worker) 直接读这张表
+CREATE TABLE IF NOT EXISTS images (
+  id TEXT PRIMARY KEY,
+  file_name TEXT,
+  origin_id TEXT,
+  caption TEXT,
+  tags TEXT,
+  created_at INTEGER,
+  width INTEGER,
+  height INTEGER
+);
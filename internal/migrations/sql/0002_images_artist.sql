@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN artist TEXT;
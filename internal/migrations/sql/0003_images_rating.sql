@@ -0,0 +1,2 @@
+-- safe / questionable / explicit
+ALTER TABLE images ADD COLUMN rating TEXT;
@@ -0,0 +1,2 @@
+-- 标签词典规范化之前的原始标签
+ALTER TABLE images ADD COLUMN raw_tags TEXT;
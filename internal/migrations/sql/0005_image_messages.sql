@@ -0,0 +1,9 @@
+-- 分流/镜像后每份副本所在的频道和消息
+CREATE TABLE IF NOT EXISTS image_messages (
+  image_id TEXT,
+  chat_id INTEGER,
+  message_id INTEGER,
+  doc_message_id INTEGER,
+  created_at INTEGER,
+  PRIMARY KEY (image_id, chat_id)
+);
@@ -0,0 +1,40 @@
+-- 结构化的作品 / 分页 / 标签
+CREATE TABLE IF NOT EXISTS artworks (
+  id TEXT PRIMARY KEY,
+  source TEXT,
+  source_url TEXT,
+  title TEXT,
+  artist_id TEXT,
+  artist TEXT,
+  rating TEXT,
+  page_count INTEGER,
+  created_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS pages (
+  id TEXT PRIMARY KEY,
+  artwork_id TEXT,
+  page_index INTEGER,
+  file_id TEXT,
+  origin_id TEXT,
+  width INTEGER,
+  height INTEGER,
+  created_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_pages_artwork ON pages (artwork_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT UNIQUE,
+  kind TEXT
+);
+
+CREATE TABLE IF NOT EXISTS artwork_tags (
+  artwork_id TEXT,
+  tag_id INTEGER,
+  raw TEXT,
+  PRIMARY KEY (artwork_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_artwork_tags_tag ON artwork_tags (tag_id);
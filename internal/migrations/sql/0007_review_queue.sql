@@ -0,0 +1,8 @@
+-- 审核模式下等待处理的作品，按审核消息 ID 查找
+CREATE TABLE IF NOT EXISTS review_queue (
+  message_id INTEGER PRIMARY KEY,
+  post_id TEXT,
+  meta TEXT,
+  created_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_review_queue_post ON review_queue (post_id);
@@ -0,0 +1,7 @@
+-- /delete 的软删除记录，/undelete 在保留期内可以恢复
+CREATE TABLE IF NOT EXISTS deleted_images (
+  id TEXT PRIMARY KEY,
+  data TEXT,
+  messages TEXT,
+  deleted_at INTEGER
+);
@@ -0,0 +1,6 @@
+-- 爬虫的翻页进度 (如 Danbooru 上次看到的 ID)，重启后接着用
+CREATE TABLE IF NOT EXISTS crawler_state (
+  name TEXT PRIMARY KEY,
+  value TEXT,
+  updated_at INTEGER
+);
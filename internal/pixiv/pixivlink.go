@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"my-bot-go/internal/rating"
 	"net/http"
 	"strings"
 	"time"
@@ -28,7 +29,9 @@ type PixivDetailResp struct {
 		IllustId    string `json:"illustId"`
 		IllustTitle string `json:"illustTitle"`
 		UserName    string `json:"userName"`
+		UserId      string `json:"userId"`
 		IllustType  int    `json:"illustType"` // 2=动图
+		XRestrict   int    `json:"xRestrict"`  // 0=全年龄 1=R-18 2=R-18G
 		Tags        struct {
 			Tags []struct {
 				Tag string `json:"tag"`
@@ -41,7 +44,10 @@ type Illust struct {
 	ID       string
 	Title    string
 	Artist   string
+	ArtistID string
 	Tags     string
+	TagList  []string
+	Rating   string
 	Pages    []PixivPage
 }
 
@@ -89,9 +95,12 @@ func GetIllust(id string, cookie string) (*Illust, error) {
 	return &Illust{
 		ID:     detail.Body.IllustId,
 		Title:  detail.Body.IllustTitle,
-		Artist: detail.Body.UserName,
-		Tags:   strings.Join(tagStrs, " "),
-		Pages:  pages.Body,
+		Artist:   detail.Body.UserName,
+		ArtistID: detail.Body.UserId,
+		Tags:     strings.Join(tagStrs, " "),
+		TagList:  tagStrs,
+		Rating:   rating.FromPixiv(detail.Body.XRestrict),
+		Pages:    pages.Body,
 	}, nil
 }
 
@@ -0,0 +1,93 @@
+package rating
+
+import "strings"
+
+// 统一的分级，入库写在 images.rating
+const (
+	Safe         = "safe"
+	Questionable = "questionable"
+	Explicit     = "explicit"
+)
+
+// R18Tag 前端 (Worker) 的 R-18 过滤器按这个标签识别
+const R18Tag = "R-18"
+
+// FromBooru 转换 booru 系站点的 rating
+// moebooru: s/q/e，danbooru: g/s/q/e，gelbooru: general/sensitive/questionable/explicit
+func FromBooru(r string) string {
+	switch strings.ToLower(strings.TrimSpace(r)) {
+	case "e", "explicit":
+		return Explicit
+	case "q", "questionable":
+		return Questionable
+	default:
+		return Safe
+	}
+}
+
+// FromPixiv 转换 Pixiv 的 x_restrict：0=全年龄，1=R-18，2=R-18G
+func FromPixiv(xRestrict int) string {
+	if xRestrict > 0 {
+		return Explicit
+	}
+	return Safe
+}
+
+// FromFlag 只有 R-18 开关的来源 (ManyACG r18、Fanbox hasAdultContent、推特敏感内容)
+func FromFlag(r18 bool) string {
+	if r18 {
+		return Explicit
+	}
+	return Safe
+}
+
+// FromTags 没有分级字段的来源，靠标签判断，识别不出时返回 fallback
+func FromTags(tags []string, fallback string) string {
+	for _, t := range tags {
+		switch strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(t), "#")) {
+		case "R-18", "R18", "R-18G", "R18G", "NSFW":
+			return Explicit
+		}
+	}
+	return fallback
+}
+
+// Normalize 校验配置或数据库里读出的值，未知值按 fallback 处理
+func Normalize(r, fallback string) string {
+	r = strings.ToLower(strings.TrimSpace(r))
+	switch r {
+	case Safe, Questionable, Explicit:
+		return r
+	}
+	return fallback
+}
+
+// IsR18 questionable 与 explicit 都算 R-18，前端默认隐藏
+func IsR18(r string) bool {
+	return r == Questionable || r == Explicit
+}
+
+// Level 用于比较分级高低
+func Level(r string) int {
+	switch r {
+	case Explicit:
+		return 2
+	case Questionable:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// WithTag 给 R-18 内容的标签串补上 R-18 标签 (已有则不重复)
+func WithTag(tags, r string) string {
+	if !IsR18(r) {
+		return tags
+	}
+	for _, t := range strings.Fields(tags) {
+		if strings.EqualFold(strings.TrimPrefix(t, "#"), R18Tag) {
+			return tags
+		}
+	}
+	return strings.TrimSpace(tags + " " + R18Tag)
+}
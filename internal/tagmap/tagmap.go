@@ -0,0 +1,251 @@
+package tagmap
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"my-bot-go/internal/rating"
+)
+
+// Danbooru / Gelbooru 的命名空间前缀，规范化时去掉
+var namespaces = []string{"artist:", "character:", "copyright:", "general:", "meta:"}
+
+// Dict 标签别名/翻译表，把各站点的写法映射到同一个规范标签
+// 文件每行一条：别名 = 规范标签，# 开头为注释，例如
+//
+//	初音ミク = 初音未来
+//	hatsune_miku = 初音未来
+type Dict struct {
+	path    string
+	mu      sync.RWMutex
+	aliases map[string]entry // key 为 Key(别名)
+	seq     int
+}
+
+// entry 一条别名，写回文件时保留原来的写法和顺序
+type entry struct {
+	alias     string
+	canonical string
+	seq       int
+}
+
+// Load 从文件读取词典，文件不存在时返回空词典，之后用命令添加会自动创建
+func Load(path string) *Dict {
+	d := &Dict{path: path, aliases: make(map[string]entry)}
+	if path == "" {
+		return d
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("tag dict load failed", "path", path, "err", err)
+		}
+		return d
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		alias, canonical, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		alias, canonical = strings.TrimSpace(alias), Clean(canonical)
+		if alias != "" && canonical != "" {
+			d.put(alias, canonical)
+		}
+	}
+	slog.Info("loaded tag aliases", "count", len(d.aliases), "path", path)
+	return d
+}
+
+// Clean 统一单个标签的写法：去掉 #、命名空间，空格换成下划线 (tags 列以空格分隔)
+func Clean(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	lower := strings.ToLower(tag)
+	for _, ns := range namespaces {
+		if strings.HasPrefix(lower, ns) {
+			tag = tag[len(ns):]
+			break
+		}
+	}
+	return strings.Join(strings.Fields(tag), "_")
+}
+
+// Key 查表用的键，忽略大小写和 _ - 空格的差异
+func Key(tag string) string {
+	tag = strings.ToLower(Clean(tag))
+	return strings.NewReplacer("_", "", "-", "", "・", "").Replace(tag)
+}
+
+// Canonical 查单个标签的规范写法，别名可以串联 (日文 -> 中文 -> 规范名)
+func (d *Dict) Canonical(tag string) string {
+	tag = Clean(tag)
+	if tag == "" || tag == rating.R18Tag {
+		return tag
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for i := 0; i < 5; i++ {
+		next, ok := d.aliases[Key(tag)]
+		if !ok || next.canonical == tag {
+			break
+		}
+		tag = next.canonical
+	}
+	return tag
+}
+
+// Normalize 把空格分隔的原始标签转成去重后的规范标签
+func (d *Dict) Normalize(tags string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range strings.Fields(tags) {
+		c := d.Canonical(t)
+		if c == "" || seen[Key(c)] {
+			continue
+		}
+		seen[Key(c)] = true
+		out = append(out, c)
+	}
+	return strings.Join(out, " ")
+}
+
+// Set 添加或修改一条别名并写回文件
+func (d *Dict) Set(alias, canonical string) error {
+	canonical = Clean(canonical)
+	if Key(alias) == "" || canonical == "" {
+		return fmt.Errorf("empty alias or canonical tag")
+	}
+	d.mu.Lock()
+	d.put(strings.TrimSpace(alias), canonical)
+	d.mu.Unlock()
+	return d.save()
+}
+
+// put 修改已有别名时只换规范标签，保留原来的写法和位置，调用方持有锁
+func (d *Dict) put(alias, canonical string) {
+	e, ok := d.aliases[Key(alias)]
+	if !ok {
+		d.seq++
+		e = entry{alias: alias, seq: d.seq}
+	}
+	e.canonical = canonical
+	d.aliases[Key(alias)] = e
+}
+
+// Delete 删除一条别名并写回文件，返回是否存在
+func (d *Dict) Delete(alias string) (bool, error) {
+	d.mu.Lock()
+	_, ok := d.aliases[Key(alias)]
+	delete(d.aliases, Key(alias))
+	d.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, d.save()
+}
+
+// Len 当前别名条数
+func (d *Dict) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.aliases)
+}
+
+func (d *Dict) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	d.mu.RLock()
+	entries := make([]entry, 0, len(d.aliases))
+	for _, e := range d.aliases {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	var sb strings.Builder
+	sb.WriteString("# 别名 = 规范标签\n")
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "%s = %s\n", e.alias, e.canonical)
+	}
+	d.mu.RUnlock()
+
+	// 先写临时文件再替换，避免写到一半进程退出把词典弄坏
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// MaxHashTagLen 单个 #标签 最多保留的字符数 (不含 #)
+const MaxHashTagLen = 64
+
+// HashTag 把一个标签转成 Telegram 里能点击的 #标签，转不出来时返回空字符串
+// Telegram 只把字母、数字和下划线当作标签的一部分，空格、- / : ( ) 等一律换成下划线
+func HashTag(tag string) string {
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	lower := strings.ToLower(tag)
+	// rating:s 这类元标签在说明里没有意义，分级由 R-18 标签表示
+	if strings.HasPrefix(lower, "rating:") {
+		return ""
+	}
+	for _, ns := range namespaces {
+		if strings.HasPrefix(lower, ns) {
+			tag = tag[len(ns):]
+			break
+		}
+	}
+
+	var runes []rune
+	for _, r := range tag {
+		// Mn/Mc 是组合用的附加符号，拆开会把泰文、天城文等切断
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc) {
+			runes = append(runes, r)
+		} else if len(runes) > 0 && runes[len(runes)-1] != '_' {
+			runes = append(runes, '_')
+		}
+	}
+	if len(runes) > MaxHashTagLen {
+		runes = runes[:MaxHashTagLen]
+	}
+	out := strings.TrimRight(string(runes), "_")
+	if out == "" {
+		return ""
+	}
+
+	// 纯数字不会被识别成标签
+	if strings.IndexFunc(out, func(r rune) bool { return !unicode.IsDigit(r) && r != '_' }) < 0 {
+		out = "_" + out
+	}
+	return "#" + out
+}
+
+// HashTags 生成说明文字里的 #标签，按 HashTag 清理后忽略大小写去重
+func HashTags(tags []string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		h := HashTag(t)
+		key := strings.ToLower(h)
+		if h == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, h)
+	}
+	return strings.Join(out, " ")
+}
@@ -8,19 +8,24 @@ import (
 	"image/jpeg"
 	_ "image/png"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"my-bot-go/internal/alert"
+	"my-bot-go/internal/caption"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
-	"my-bot-go/internal/manyacg"
-	"my-bot-go/internal/pixiv"
-	"my-bot-go/internal/yande"
-	// "my-bot-go/internal/fanbox"
+	"my-bot-go/internal/fanbox"
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/tagmap"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -31,6 +36,9 @@ type BotHandler struct {
 	API             *bot.Bot
 	Cfg             *config.Config
 	DB              *database.D1Client
+	Filter          *filter.Filter // 爬虫下载前调用 Filter.Allow
+	Tags            *tagmap.Dict   // 入库前把标签转成规范写法
+	Captions        *caption.Engine // 按来源模板生成说明文字
 	mu              sync.RWMutex // 🔴 新增互斥锁
 	Forwarding      bool
 	ForwardBaseID   string
@@ -40,12 +48,24 @@ type BotHandler struct {
 	ForwardTags     string
 	CurrentPreview  *models.Message
 	CurrentOriginal *models.Message
+
+	// 审核模式，见 review.go
+	reviewMu  sync.Mutex
+	reviewing map[int]bool // 正在处理的审核消息
+	tagEdits  map[int]int  // 编辑标签提示消息 ID -> 审核消息 ID
+
+	// 私聊浏览，见 browse.go
+	browseMu sync.Mutex
+	browsing map[int64]database.SearchQuery // 每个私聊最近一次的查询，「下一张」接着翻
+
+	links []link // RegisterLink 注册的链接处理，按注册顺序匹配
 }
 
 func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
-	h := &BotHandler{Cfg: cfg, DB: db}
+	h := &BotHandler{Cfg: cfg, DB: db, Filter: filter.New(cfg), Tags: tagmap.Load(cfg.TagDictFile), Captions: caption.New(cfg),
+		reviewing: make(map[int]bool), tagEdits: make(map[int]int), browsing: make(map[int64]database.SearchQuery)}
 
-	b, err := bot.New(cfg.BotToken)
+	b, err := bot.New(cfg.BotToken, bot.WithDefaultHandler(h.handleUpdate))
 	if err != nil {
 		return nil, err
 	}
@@ -55,19 +75,45 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 	// /save
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/save", bot.MatchTypeExact, h.handleSave)
 
-	// /delete
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/delete", bot.MatchTypePrefix, h.handleDelete)
+	// /filter_stats
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/filter_stats", bot.MatchTypeExact, h.handleFilterStats)
+
+	// /stats 运行统计
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/stats", bot.MatchTypeExact, h.handleStats)
 
-	// Pixiv Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "pixiv.net/artworks/", bot.MatchTypeContains, h.handlePixivLink)
+	// /mute <来源> <时长> 暂停某个来源的错误提醒
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/mute", bot.MatchTypePrefix, h.handleMute)
+
+	// 标签词典
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/tag_alias", bot.MatchTypePrefix, h.handleTagAlias)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/tag_unalias", bot.MatchTypePrefix, h.handleTagUnalias)
+
+	// /migrate 把旧 images 表解析成结构化表
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/migrate", bot.MatchTypeExact, h.handleMigrate)
+
+	// 审核按钮
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "review:", bot.MatchTypePrefix, h.handleReview)
+
+	// /delete /undelete
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/delete", bot.MatchTypePrefix, h.handleDelete)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/undelete", bot.MatchTypePrefix, h.handleUndelete)
 
-	// ManyACG Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "manyacg.top/artwork/", bot.MatchTypeContains, h.handleManyacgLink)
+	// /edit 修改已发布图片的标题、作者、标签
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/edit", bot.MatchTypePrefix, h.handleEdit)
 
-	// Yande Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "yande.re/post/show/", bot.MatchTypeContains, h.handleYandeLink)
+	// 私聊浏览图库
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/random", bot.MatchTypePrefix, h.handleBrowse)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/search", bot.MatchTypePrefix, h.handleBrowse)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/artist", bot.MatchTypePrefix, h.handleBrowse)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/latest", bot.MatchTypePrefix, h.handleBrowse)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "browse:", bot.MatchTypePrefix, h.handleBrowseButton)
 
-	//b.RegisterHandler(bot.HandlerTypeMessageText, "fanbox.cc/@", bot.MatchTypeContains, h.handleFanboxLink)
+	// 作品链接，抓取逻辑见 links.go，命令行的 bot fetch 也走这里
+	// yande.re、danbooru 等 booru 站点的链接由 crawler.RegisterBooruLinks 注册
+	h.RegisterLink(pixivLinkRe, "Pixiv", h.fetchPixivLink)
+	h.RegisterLink(manyacgLinkRe, "ManyACG", h.fetchManyacgLink)
+	h.RegisterLink(twitterLinkRe, "Twitter", h.fetchTwitterLink)
+	h.RegisterLink(fanbox.PostLinkRe, "Fanbox", h.fetchFanboxLink)
 
 	// Forward Commands
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_start", bot.MatchTypePrefix, h.handleForwardStart)
@@ -85,6 +131,11 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 			return
 		}
 
+		// 审核群里编辑标签的回复
+		if h.handleTagReply(b, update.Message) {
+			return
+		}
+
 		// 加读锁检查状态
 		h.mu.RLock()
 		isForwarding := h.Forwarding
@@ -110,7 +161,7 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 					h.CurrentPreview = msg
 					h.CurrentOriginal = nil
 
-					log.Printf("🖼 [Forward] 收到 P%d 预览图", h.ForwardIndex)
+					slog.Info("forward preview received", "page", h.ForwardIndex)
 					b.SendMessage(bgCtx, &bot.SendMessageParams{
 						ChatID:          msg.Chat.ID,
 						Text:            fmt.Sprintf("✅ yukiyuki获取到 P%d 预览图啦，主人请发送原图文件(Document)吧，喵~🐱", h.ForwardIndex),
@@ -128,7 +179,7 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 						h.CurrentOriginal = msg
 					}
 
-					log.Printf("📄 [Forward] 收到 P%d 原图", h.ForwardIndex)
+					slog.Info("forward original received", "page", h.ForwardIndex)
 					b.SendMessage(bgCtx, &bot.SendMessageParams{
 						ChatID:          msg.Chat.ID,
 						Text:            fmt.Sprintf("✅ P%d 就绪了喵~🐱。\n请输入 /forward_continue 发布并继续下一张\n或 /forward_end 发布并结束（^v^）。", h.ForwardIndex),
@@ -152,7 +203,84 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 }
 
 func (h *BotHandler) Start(ctx context.Context) {
+	go h.heartbeat(ctx)
+	metrics.SetPolling(true)
 	h.API.Start(ctx)
+	metrics.SetPolling(false)
+}
+
+// heartbeat 每分钟调一次 getMe，给 /healthz 判断 Telegram 是否可用
+func (h *BotHandler) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if _, err := h.API.GetMe(ctx); err == nil {
+			metrics.TelegramOK()
+		} else if ctx.Err() == nil {
+			slog.Warn("telegram heartbeat failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LinkFunc 处理消息里的链接，返回成功发送和跳过重复的张数
+type LinkFunc func(ctx context.Context, text string) (sent int, skipped int, err error)
+
+type link struct {
+	re   *regexp.Regexp
+	name string
+	fn   LinkFunc
+}
+
+// RegisterLink 供其他包 (如 crawler 里的 booru 适配器) 注册链接处理
+// re 要带上站点域名，只有匹配的消息才会回复，加载提示、结果汇报等聊天交互统一在这里完成
+func (h *BotHandler) RegisterLink(re *regexp.Regexp, name string, fn LinkFunc) {
+	h.links = append(h.links, link{re: re, name: name, fn: fn})
+	match := func(update *models.Update) bool {
+		return update.Message != nil && re.MatchString(update.Message.Text)
+	}
+	h.API.RegisterHandlerMatchFunc(match, func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if h.Forwarding {
+			return
+		}
+
+		go func() {
+			bgCtx := context.Background()
+
+			loadingMsg, _ := b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID:          update.Message.Chat.ID,
+				Text:            "⏳ 正在抓取 " + name + " 链接了喵~🐱 ...",
+				ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+			})
+
+			sent, skipped, err := fn(bgCtx, update.Message.Text)
+
+			if loadingMsg != nil {
+				b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{
+					ChatID:    update.Message.Chat.ID,
+					MessageID: loadingMsg.ID,
+				})
+			}
+
+			if err != nil {
+				b.SendMessage(bgCtx, &bot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   "❌ 获取失败: " + err.Error(),
+				})
+				return
+			}
+
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID:          update.Message.Chat.ID,
+				Text:            fmt.Sprintf("✅ 处理完成了喵~🐱！\n成功发送: %d 张\n跳过重复: %d 张", sent, skipped),
+				ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+			})
+		}()
+	})
 }
 
 func (h *BotHandler) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
@@ -169,44 +297,105 @@ func (h *BotHandler) downloadFile(ctx context.Context, fileID string) ([]byte, e
 	return io.ReadAll(resp.Body)
 }
 
-func (h *BotHandler) ProcessAndSend(ctx context.Context, imgData []byte, postID, tags, caption, artist, source string, width, height int) {
+// targetChannel R-18 内容在配置了 NSFW_CHANNEL_ID 时分流到单独的频道
+func (h *BotHandler) targetChannel(rate string) int64 {
+	if h.Cfg.NSFWChannelID != 0 && rating.Level(rate) >= rating.Level(h.Cfg.NSFWMinRating) {
+		return h.Cfg.NSFWChannelID
+	}
+	return h.Cfg.ChannelID
+}
+
+// normalizeTags 按标签词典填写规范名并去重，R-18 内容补上前端过滤用的标签
+func (h *BotHandler) normalizeTags(meta *database.ImageMeta) {
+	seen := make(map[string]bool)
+	var tags []database.Tag
+	for _, t := range meta.Tags {
+		t.Name = h.Tags.Canonical(t.Raw)
+		key := tagmap.Key(t.Name)
+		if t.Name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, t)
+	}
+	meta.Tags = tags
+	if rating.IsR18(meta.Rating) {
+		meta.AddTag(rating.R18Tag, database.TagMeta)
+	}
+}
+
+// ProcessAndSend 压缩后发到频道 (或审核群) 并入库
+// 发送成功、之前发过或演练时返回 true，Telegram 或 D1 失败时返回 false，调用方可以据此决定要不要重试
+func (h *BotHandler) ProcessAndSend(ctx context.Context, imgData []byte, meta database.ImageMeta) bool {
+	postID, source := meta.PostID, meta.Source
+	width, height := meta.Width, meta.Height
+	_, page := meta.Artwork()
+	logger := logging.Post(source, postID).With("page", page)
 	if h.DB.History[postID] {
-		log.Printf("⏭️ Skip %s: already in history", postID)
-		return
+		metrics.Count(source, metrics.Duplicate)
+		logger.Debug("skip, already in history")
+		return true
 	}
+	metrics.Count(source, metrics.Fetched)
+	metrics.Downloaded(len(imgData))
+	h.normalizeTags(&meta)
+	meta.Caption = h.Captions.Plain(meta)
+	text, parseMode := h.Captions.Render(meta)
+	chats := h.routeChats(RouteInfo{Source: source, Rating: meta.Rating, Tags: meta.TagNames(), Artist: meta.Artist, Width: width, Height: height})
+	chatID := chats[0]
+
 	const MaxPhotoSize = 9 * 1024 * 1024
 	shouldCompress := int64(len(imgData)) > MaxPhotoSize || (width > 4950 || height > 4950)
 	finalData := imgData
 
 	if shouldCompress {
-		log.Printf("⚠️ Image %s needs processing (Size: %.2f MB, Dim: %dx%d)...", postID, float64(len(imgData))/1024/1024, width, height)
+		logger.Info("image needs compression", "bytes", len(imgData), "width", width, "height", height)
 		compressed, err := compressImage(imgData, MaxPhotoSize)
 		if err != nil {
-			log.Printf("❌ Compression failed: %v. Trying original...", err)
+			logger.Warn("compression failed, trying original", "err", err)
 		} else {
 			finalData = compressed
 		}
 	}
 
+	// 演练到这里为止：把要发的和要存的打出来，不碰 Telegram 和 D1
+	if h.DryRun(ctx) {
+		logger.Info("dry run, would send",
+			"chats", chats, "review", h.needsReview(source),
+			"bytes", len(finalData), "original_bytes", len(imgData), "compressed", len(finalData) != len(imgData),
+			"title", meta.Title, "artist", meta.Artist, "rating", meta.Rating, "tags", meta.TagNames(),
+			"source_url", meta.SourceURL, "parse_mode", parseMode, "caption", text)
+		return true
+	}
+
+	if h.needsReview(source) {
+		return h.sendToReview(ctx, finalData, imgData, meta)
+	}
+
 	params := &bot.SendPhotoParams{
-		ChatID:  h.Cfg.ChannelID,
-		Photo:   &models.InputFileUpload{Filename: source + ".jpg", Data: bytes.NewReader(finalData)},
-		Caption: caption,
+		ChatID:    chatID,
+		Photo:     &models.InputFileUpload{Filename: source + ".jpg", Data: bytes.NewReader(finalData)},
+		Caption:   text,
+		ParseMode: parseMode,
 	}
 
+	sendStart := time.Now()
 	msg, err := h.API.SendPhoto(ctx, params)
 	if err != nil {
-		log.Printf("❌ Telegram Send Failed [%s]: %v", postID, err)
-		return
+		metrics.Count(source, metrics.Failed)
+		logger.Error("telegram send failed", "chat_id", chatID, "err", err)
+		return false
 	}
+	metrics.SendLatency(time.Since(sendStart))
 
 	if len(msg.Photo) == 0 {
-		return
+		metrics.Count(source, metrics.Failed)
+		return false
 	}
 	fileID := msg.Photo[len(msg.Photo)-1].FileID
 
 	docParams := &bot.SendDocumentParams{
-		ChatID: h.Cfg.ChannelID,
+		ChatID: chatID,
 		Document: &models.InputFileUpload{
 			Filename: source + "_original.jpg",
 			Data:     bytes.NewReader(imgData),
@@ -218,29 +407,79 @@ func (h *BotHandler) ProcessAndSend(ctx context.Context, imgData []byte, postID,
 	}
 
 	var originFileID string
+	docMsgID := 0
 	msgDoc, errDoc := h.API.SendDocument(ctx, docParams)
 	if errDoc != nil {
-		log.Printf("⚠️ SendDocument Failed (Will only save preview): %v", errDoc)
+		logger.Warn("send original failed, will only save preview", "chat_id", chatID, "err", errDoc)
 		originFileID = ""
 	} else {
 		originFileID = msgDoc.Document.FileID
+		docMsgID = msgDoc.ID
 	}
 
-	err = h.DB.SaveImage(postID, fileID, originFileID, caption, artist, tags, source, width, height)
+	meta.FileID, meta.OriginID = fileID, originFileID
+	err = h.DB.SaveImage(meta)
 	if err != nil {
-		log.Printf("❌ D1 Save Failed: %v", err)
-	} else {
-		log.Printf("✅ Saved: %s (Preview + Origin)", postID)
+		metrics.Count(source, metrics.Failed)
+		logger.Error("d1 save failed", "err", err)
+		return false
+	}
+	metrics.Count(source, metrics.Sent)
+	logger.Info("sent", "chat_id", chatID, "original", originFileID != "")
+
+	h.recordMessage(postID, chatID, msg.ID, docMsgID)
+	h.mirrorCopies(ctx, chats[1:], postID, fileID, originFileID, text, parseMode)
+	return true
+}
+
+// mirrorCopies 主频道发完后，用 file_id 把图和原图转发到其余频道，不用重新上传
+func (h *BotHandler) mirrorCopies(ctx context.Context, chats []int64, postID, fileID, originFileID, text string, parseMode models.ParseMode) {
+	for _, chatID := range chats {
+		msg, err := h.API.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:    chatID,
+			Photo:     &models.InputFileString{Data: fileID},
+			Caption:   text,
+			ParseMode: parseMode,
+		})
+		if err != nil {
+			slog.Warn("mirror failed", "post_id", postID, "chat_id", chatID, "err", err)
+			continue
+		}
+
+		docMsgID := 0
+		if originFileID != "" {
+			docMsg, err := h.API.SendDocument(ctx, &bot.SendDocumentParams{
+				ChatID:          chatID,
+				Document:        &models.InputFileString{Data: originFileID},
+				ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+				Caption:         "⬇️ Original File",
+			})
+			if err != nil {
+				slog.Warn("mirror original failed", "post_id", postID, "chat_id", chatID, "err", err)
+			} else {
+				docMsgID = docMsg.ID
+			}
+		}
+
+		h.recordMessage(postID, chatID, msg.ID, docMsgID)
+		slog.Info("mirrored", "post_id", postID, "chat_id", chatID)
+	}
+}
+
+// recordMessage 记录副本位置，失败只打日志
+func (h *BotHandler) recordMessage(postID string, chatID int64, messageID, docMessageID int) {
+	if err := h.DB.SaveMessage(postID, chatID, messageID, docMessageID); err != nil {
+		slog.Warn("d1 save message failed", "post_id", postID, "chat_id", chatID, "err", err)
 	}
 }
 
 func (h *BotHandler) handleSave(ctx context.Context, b *bot.Bot, update *models.Update) {
 	userID := update.Message.From.ID
 	if userID != 8040798522 && userID != 6874581126 {
-		log.Printf("⛔ Unauthorized /save attempt from UserID: %d", userID)
+		slog.Warn("unauthorized /save attempt", "user_id", userID)
 		return
 	}
-	log.Printf("💾 Manual save triggered by UserID: %d", userID)
+	slog.Info("manual save triggered", "user_id", userID)
 	if h.DB != nil {
 		h.DB.PushHistory()
 		b.SendMessage(ctx, &bot.SendMessageParams{
@@ -255,6 +494,137 @@ func (h *BotHandler) handleSave(ctx context.Context, b *bot.Bot, update *models.
 	}
 }
 
+func (h *BotHandler) handleFilterStats(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   "🚫 Filter Stats\n" + h.Filter.Stats(),
+	})
+}
+
+// handleStats 各来源计数、爬虫时间表、History 大小、D1 错误率和发送耗时
+func (h *BotHandler) handleStats(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   metrics.Report(h.DB.HistorySize()) + "\n\n🚫 Filter: " + h.Filter.Stats(),
+	})
+}
+
+// handleMute /mute 列出静音，/mute <来源|all> <时长|off> 设置或取消
+func (h *BotHandler) handleMute(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+
+	parts := strings.Fields(update.Message.Text)
+	var text string
+	switch {
+	case len(parts) == 1:
+		muted := alert.Muted()
+		if len(muted) == 0 {
+			text = "🔔 现在没有静音的来源喵~"
+			break
+		}
+		var lines []string
+		for source, until := range muted {
+			lines = append(lines, fmt.Sprintf("🔕 %s 到 %s", source, until.Format("01-02 15:04")))
+		}
+		sort.Strings(lines)
+		text = strings.Join(lines, "\n")
+	case len(parts) == 3 && strings.EqualFold(parts[2], "off"):
+		alert.Mute(parts[1], 0)
+		text = fmt.Sprintf("🔔 %s 的提醒恢复了喵~", strings.ToLower(parts[1]))
+	case len(parts) == 3:
+		d, err := alert.ParseDuration(parts[2])
+		if err != nil || d <= 0 {
+			text = "⚠️ 时长格式不对喵，例如 30m、2h、1d"
+			break
+		}
+		alert.Mute(parts[1], d)
+		text = fmt.Sprintf("🔕 %s 的提醒静音到 %s 喵~ (仍会计入日报)", strings.ToLower(parts[1]), time.Now().Add(d).Format("01-02 15:04"))
+	default:
+		text = "⚠️ 格式：/mute <来源|all> <时长|off>\n例如：/mute danbooru 2h"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: update.Message.Chat.ID, Text: text})
+}
+
+// handleTagAlias /tag_alias <别名> <规范标签>，不带规范标签时查询当前映射
+func (h *BotHandler) handleTagAlias(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+
+	parts := strings.Fields(update.Message.Text)
+	var text string
+	switch {
+	case len(parts) == 2:
+		text = fmt.Sprintf("🏷 %s → %s", parts[1], h.Tags.Canonical(parts[1]))
+	case len(parts) == 3:
+		if err := h.Tags.Set(parts[1], parts[2]); err != nil {
+			text = "❌ 保存失败喵: " + err.Error()
+		} else {
+			text = fmt.Sprintf("✅ %s → %s (共 %d 条)", parts[1], h.Tags.Canonical(parts[1]), h.Tags.Len())
+		}
+	default:
+		text = "⚠️ 格式：/tag_alias <别名> <规范标签>\n例如：/tag_alias 初音ミク 初音未来"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: update.Message.Chat.ID, Text: text})
+}
+
+// handleTagUnalias /tag_unalias <别名>
+func (h *BotHandler) handleTagUnalias(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+
+	parts := strings.Fields(update.Message.Text)
+	if len(parts) != 2 {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: update.Message.Chat.ID, Text: "⚠️ 格式：/tag_unalias <别名>"})
+		return
+	}
+
+	text := fmt.Sprintf("🗑 已删除 %s", parts[1])
+	ok, err := h.Tags.Delete(parts[1])
+	if err != nil {
+		text = "❌ 保存失败喵: " + err.Error()
+	} else if !ok {
+		text = fmt.Sprintf("⚠️ 词典里没有 %s", parts[1])
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: update.Message.Chat.ID, Text: text})
+}
+
+func (h *BotHandler) handleMigrate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if userID != 8040798522 && userID != 6874581126 {
+		return
+	}
+
+	go func() {
+		bgCtx := context.Background()
+		chatID := update.Message.Chat.ID
+		b.SendMessage(bgCtx, &bot.SendMessageParams{ChatID: chatID, Text: "⏳ 开始迁移旧数据了喵~"})
+
+		done, err := h.DB.MigrateLegacy(func(done int) {
+			slog.Info("migrated legacy rows", "done", done)
+		})
+		text := fmt.Sprintf("✅ 迁移完成，共 %d 条喵~", done)
+		if err != nil {
+			text = fmt.Sprintf("❌ 迁移到第 %d 条时出错: %v", done, err)
+		}
+		b.SendMessage(bgCtx, &bot.SendMessageParams{ChatID: chatID, Text: text})
+	}()
+}
+
 func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.Message == nil || len(update.Message.Photo) == 0 {
 		return
@@ -265,8 +635,30 @@ func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *model
 	if caption == "" {
 		caption = "MtcACG:TG"
 	}
+	meta := database.ImageMeta{
+		PostID:  postID,
+		Source:  "TG-C",
+		Caption: caption,
+		Artist:  "Forward",
+		Rating:  rating.FromTags(strings.Fields(caption), rating.Safe),
+		Tags:    database.NewTags(database.TagGeneral, "TG-forward"),
+		Width:   photo.Width,
+		Height:  photo.Height,
+	}
+	h.normalizeTags(&meta)
+	chats := h.routeChats(RouteInfo{Source: meta.Source, Rating: meta.Rating, Tags: strings.Fields(caption), Artist: meta.Artist, Width: photo.Width, Height: photo.Height})
+	// 和 ProcessAndSend 一样，演练时不发频道也不写 D1
+	if h.DryRun(ctx) {
+		logging.Post(meta.Source, postID).Info("dry run, would send", "chats", chats, "rating", meta.Rating, "caption", caption)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            "🧪 演练模式，没有发送也没有保存喵~",
+			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+		})
+		return
+	}
 	msg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-		ChatID:  h.Cfg.ChannelID,
+		ChatID:  chats[0],
 		Photo:   &models.InputFileString{Data: photo.FileID},
 		Caption: caption,
 	})
@@ -278,9 +670,11 @@ func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *model
 		return
 	}
 	finalFileID := msg.Photo[len(msg.Photo)-1].FileID
-	width := photo.Width
-	height := photo.Height
-	h.DB.SaveImage(postID, finalFileID, "", caption, "Forward", "TG-forward", "TG-C", width, height)
+	meta.FileID = finalFileID
+	if err := h.DB.SaveImage(meta); err == nil {
+		h.recordMessage(postID, chats[0], msg.ID, 0)
+		h.mirrorCopies(ctx, chats[1:], postID, finalFileID, "", caption, "")
+	}
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:          update.Message.Chat.ID,
 		Text:            "✅ handleManual Saved to D1!",
@@ -378,30 +772,55 @@ func (h *BotHandler) publishCurrentItem(ctx context.Context, b *bot.Bot, chatID
     }
 	caption = fmt.Sprintf("%s [P%d]", caption, index+1)
 	if tags != "" {
-		caption = caption + "\n" + tags
+		caption = caption + "\n" + tagmap.HashTags(strings.Fields(tags))
 	}
 
+	rate := rating.FromTags(strings.Fields(tags), rating.Safe)
+
 	dbTags := tags
 	if dbTags == "" {
 		dbTags = "TG-Forward"
 	}
+	meta := database.ImageMeta{
+		PostID:    postID,
+		ArtworkID: baseID,
+		PageIndex: index,
+		Source:    "TG-Forward",
+		Title:     title,
+		Caption:   caption,
+		Artist:    artist,
+		Rating:    rate,
+		Tags:      database.NewTags(database.TagGeneral, strings.Fields(dbTags)...),
+	}
+	h.normalizeTags(&meta)
+
+	// 演练时只记下要发布的内容，照常推进页码，转发流程可以完整走一遍
+	if h.DryRun(ctx) {
+		logging.Post(meta.Source, postID).Info("dry run, would publish",
+			"page", index, "title", title, "artist", artist, "rating", rate, "tags", meta.TagNames(), "caption", caption)
+		return true
+	}
 
 	var previewFileID, originFileID string
 	var width, height int
+	var chats []int64
+	var previewMsgID, docMsgID int
 
 	// 发送预览图
 	if len(preview.Photo) > 0 {
 		srcPhoto := preview.Photo[len(preview.Photo)-1]
+		chats = h.routeChats(RouteInfo{Source: meta.Source, Rating: rate, Tags: meta.TagNames(), Artist: artist, Width: srcPhoto.Width, Height: srcPhoto.Height})
 		fwdMsg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:  h.Cfg.ChannelID,
+			ChatID:  chats[0],
 			Photo:   &models.InputFileString{Data: srcPhoto.FileID},
 			Caption: caption,
 		})
 		if err != nil {
-			log.Printf("❌ P%d Preview Send Failed: %v", index, err)
+			slog.Error("forward preview send failed", "post_id", postID, "page", index, "err", err)
 			return false
 		}
 		previewFileID = fwdMsg.Photo[len(fwdMsg.Photo)-1].FileID
+		previewMsgID = fwdMsg.ID
 		width = srcPhoto.Width
 		height = srcPhoto.Height
 
@@ -410,17 +829,19 @@ func (h *BotHandler) publishCurrentItem(ctx context.Context, b *bot.Bot, chatID
 		}
 	} else if preview.Document != nil {
 		srcDoc := preview.Document
+		chats = h.routeChats(RouteInfo{Source: meta.Source, Rating: rate, Tags: meta.TagNames(), Artist: artist})
 		fwdMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:   h.Cfg.ChannelID,
+			ChatID:   chats[0],
 			Document: &models.InputFileString{Data: srcDoc.FileID},
 			Caption:  caption,
 		})
 		if err != nil {
-			log.Printf("❌ P%d Doc Send Failed: %v", index, err)
+			slog.Error("forward document send failed", "post_id", postID, "page", index, "err", err)
 			return false
 		}
 		previewFileID = fwdMsg.Document.FileID
 		originFileID = fwdMsg.Document.FileID
+		previewMsgID = fwdMsg.ID
 		if fwdMsg.Document.Thumbnail != nil {
 			width = fwdMsg.Document.Thumbnail.Width
 			height = fwdMsg.Document.Thumbnail.Height
@@ -430,24 +851,33 @@ func (h *BotHandler) publishCurrentItem(ctx context.Context, b *bot.Bot, chatID
 	// 补发原图
 	if originFileID != "" && originFileID != previewFileID {
 		docMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:   h.Cfg.ChannelID,
+			ChatID:   chats[0],
 			Document: &models.InputFileString{Data: originFileID},
 			Caption:  fmt.Sprintf("⬇️ %s P%d Original", title, index),
 		})
 		if err == nil {
 			originFileID = docMsg.Document.FileID
+			docMsgID = docMsg.ID
 		}
 	}
 
 	// 存入数据库
-	err := h.DB.SaveImage(postID, previewFileID, originFileID, caption, artist, dbTags, "TG-Forward", width, height)
+	meta.FileID, meta.OriginID = previewFileID, originFileID
+	meta.Width, meta.Height = width, height
+	err := h.DB.SaveImage(meta)
 	if err != nil {
-		log.Printf("❌ P%d DB Save Failed: %v", index, err)
+		slog.Error("d1 save failed", "post_id", postID, "page", index, "err", err)
 		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "❌ 糟了！数据库保存失败，流程暂停。喵呜(^x_x^)"})
 		return false
 	}
 
-	log.Printf("✅ Published: %s", postID)
+	h.recordMessage(postID, chats[0], previewMsgID, docMsgID)
+	// 以文件形式发的预览没有 photo file_id，暂不镜像
+	if previewFileID != originFileID {
+		h.mirrorCopies(ctx, chats[1:], postID, previewFileID, originFileID, caption, "")
+	}
+
+	slog.Info("published", "post_id", postID, "page", index)
 	return true
 }
 
@@ -534,14 +964,14 @@ func compressImage(data []byte, targetSize int64) ([]byte, error) {
 	width := bounds.Dx()
 	height := bounds.Dy()
 	if width > 4950 || height > 4950 {
-		log.Printf("📏 Resizing image from %dx%d (Too big for TG)", width, height)
+		slog.Debug("resizing image", "width", width, "height", height)
 		if width > height {
 			img = resize.Resize(4950, 0, img, resize.Lanczos3)
 		} else {
 			img = resize.Resize(0, 4950, img, resize.Lanczos3)
 		}
 	}
-	log.Printf("📉 Compressing %s image...", format)
+	slog.Debug("compressing image", "format", format)
 	quality := 100
 	for {
 		buf := new(bytes.Buffer)
@@ -552,347 +982,208 @@ func compressImage(data []byte, targetSize int64) ([]byte, error) {
 		compressedData := buf.Bytes()
 		size := int64(len(compressedData))
 		if size <= targetSize || quality <= 50 {
-			log.Printf("✅ Compressed to %.2f MB (Quality: %d)", float64(size)/1024/1024, quality)
+			slog.Info("compressed", "bytes", size, "quality", quality)
 			return compressedData, nil
 		}
 		quality -= 1
 	}
 }
 
-func (h *BotHandler) handlePixivLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
-		return
-	}
-
+// handleDelete /delete <ID>...，以 _ 或 * 结尾的参数按前缀匹配，也可以回复频道消息直接删除
+// 数据库记录先进回收站，频道里的图和原图消息一起删掉
+func (h *BotHandler) handleDelete(ctx context.Context, b *bot.Bot, update *models.Update) {
 	go func() {
 		bgCtx := context.Background()
 
-		text := update.Message.Text
-		re := regexp.MustCompile(`artworks/(\d+)`)
-		matches := re.FindStringSubmatch(text)
-		if len(matches) < 2 {
+		userID := update.Message.From.ID
+		if userID != 8040798522 && userID != 6874581126 {
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   "⛔ 你没有权限执行删除操作喵~",
+			})
 			return
 		}
-		illustID := matches[1]
 
-		loadingMsg, _ := b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:          update.Message.Chat.ID,
-			Text:            "⏳ 正在抓取 Pixiv ID 了喵~🐱: " + illustID + " ...",
-			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
-		})
+		args := strings.Fields(update.Message.Text)[1:]
+		if id := h.repliedImageID(update.Message); id != "" {
+			args = append(args, id)
+		}
 
-		illust, err := pixiv.GetIllust(illustID, h.Cfg.PixivPHPSESSID)
-		if err != nil {
+		if len(args) == 0 {
 			b.SendMessage(bgCtx, &bot.SendMessageParams{
 				ChatID: update.Message.Chat.ID,
-				Text:   "❌ 获取失败: " + err.Error(),
+				Text:   "⚠️ 格式不对喵🐱！~请输入：/delete <ID>...\n例如：/delete pixiv_114514_p0\n整个作品：/delete pixiv_114514_\n或者回复频道里的图发 /delete。再输错，小心本喵帮你格式化🐱嗷~",
 			})
 			return
 		}
 
-		successCount := 0
-		skippedCount := 0
-
-		for i, page := range illust.Pages {
-			imgData, err := pixiv.DownloadImage(page.Urls.Original, h.Cfg.PixivPHPSESSID)
-			if err != nil {
-				fmt.Printf("❌ Pixiv Download Failed: %v\n", err)
-				continue
-			}
-			pid := fmt.Sprintf("pixiv_%s_p%d", illust.ID, i)
-			caption := fmt.Sprintf("Pixiv: %s [P%d/%d]\nArtist: %s\nTags: #%s",
-				illust.Title, i+1, len(illust.Pages),
-				illust.Artist,
-				strings.ReplaceAll(illust.Tags, " ", " #"))
-
-			if h.DB.CheckExists(pid) {
-				skippedCount++
-				continue
-			}
-			h.ProcessAndSend(bgCtx, imgData, pid, illust.Tags, caption, illust.Artist, "pixiv", page.Width, page.Height)
-			successCount++
-			time.Sleep(1 * time.Second)
+		deleted, notes := h.DeleteImages(bgCtx, args)
+		text := fmt.Sprintf("🗑️🐱Yuki猫猫已经帮主人清理干净了喵~! 共删除 %d 张。", deleted)
+		if deleted > 0 {
+			text += fmt.Sprintf("\n%d 小时内可以用 /undelete <ID> 恢复。", h.Cfg.UndeleteHours)
+		}
+		if len(notes) > 0 {
+			text += "\n" + strings.Join(notes, "\n")
 		}
-
-		finalText := fmt.Sprintf("✅ 处理完成了喵~🐱！\n成功发送: %d 张\n跳过重复: %d 张", successCount, skippedCount)
 		b.SendMessage(bgCtx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   finalText,
+			Text:   text,
 		})
-
-		if loadingMsg != nil {
-			b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{
-				ChatID:    update.Message.Chat.ID,
-				MessageID: loadingMsg.ID,
-			})
-		}
 	}()
 }
 
-func (h *BotHandler) handleManyacgLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
-		return
-	}
+// 前缀删除一次最多处理的张数，防止手滑删光一个来源
+const maxBulkDelete = 100
 
-	go func() {
-		bgCtx := context.Background()
+// 前缀最后一段要带数字 (作品 ID)，只写来源的 pixiv_、yande_pool_ 会匹配到不相关的图
+var artworkPrefixRe = regexp.MustCompile(`^[^_]+_(?:[^_]+_)*[^_]*\d[^_]*_$`)
 
-		text := update.Message.Text
-		re := regexp.MustCompile(`manyacg\.top/artwork/[a-zA-Z0-9]+`)
-		matches := re.FindStringSubmatch(text)
-		if len(matches) < 1 {
-			return
-		}
-		artworkURL := matches[0]
-
-		loadingMsg, _ := b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:          update.Message.Chat.ID,
-			Text:            "⏳ 正在抓取 ManyACG 链接...了 喵~🐱",
-			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
-		})
+// findByArtworkPrefix /delete 和 /edit 共用：参数以 _ 或 * 结尾时按作品前缀查出所有分页，否则原样返回
+func (h *BotHandler) findByArtworkPrefix(arg string) ([]string, error) {
+	if !strings.HasSuffix(arg, "*") && !strings.HasSuffix(arg, "_") {
+		return []string{arg}, nil
+	}
+	prefix := strings.TrimSuffix(arg, "*")
+	// pixiv_114514* 和 pixiv_114514_ 一样按整个作品处理，不会连 pixiv_1145140_ 一起匹配
+	if !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	if !artworkPrefixRe.MatchString(prefix) {
+		return nil, fmt.Errorf("前缀要带上作品 ID，如 pixiv_114514_")
+	}
+	return h.DB.FindByPrefix(prefix, maxBulkDelete)
+}
 
-		artwork, err := manyacg.GetArtworkInfo(artworkURL)
+// DeleteImages 删除一组 ID，以 _ 或 * 结尾的按作品前缀 (如 pixiv_114514_) 匹配，返回删除的张数和需要告诉用户的提示
+// /delete 和命令行的 bot delete 共用
+func (h *BotHandler) DeleteImages(ctx context.Context, args []string) (int, []string) {
+	var ids []string
+	var notes []string
+	for _, arg := range args {
+		matched, err := h.findByArtworkPrefix(arg)
 		if err != nil {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "❌ 获取失败: " + err.Error(),
-			})
-			return
+			notes = append(notes, fmt.Sprintf("❌ %s: %v", arg, err))
+			continue
 		}
-
-		successCount := 0
-		skippedCount := 0
-
-		for i, pic := range artwork.Pictures {
-			imgData, err := manyacg.DownloadOriginal(bgCtx, pic.ID)
-			if err != nil {
-				fmt.Printf("❌ ManyACG Download Failed: %v\n", err)
-				continue
-			}
-
-			pid := fmt.Sprintf("mtcacg_%s_p%d", artwork.ID, i)
-			caption := fmt.Sprintf("MtcACG: %s [P%d/%d]\nArtist: %s\nTags: %s",
-				artwork.Title, i+1, len(artwork.Pictures),
-				artwork.Artist,
-				manyacg.FormatTags(artwork.Tags))
-
-			if h.DB.CheckExists(pid) {
-				skippedCount++
-				continue
-			}
-
-			h.ProcessAndSend(bgCtx, imgData, pid, manyacg.FormatTags(artwork.Tags), caption, artwork.Artist.Name, "manyacg", pic.Width, pic.Height)
-			successCount++
-			time.Sleep(1 * time.Second)
+		if len(matched) == 0 {
+			notes = append(notes, fmt.Sprintf("⚠️ %s 没有匹配的图", arg))
 		}
+		ids = append(ids, matched...)
+	}
+	if len(ids) > maxBulkDelete {
+		ids = ids[:maxBulkDelete]
+		notes = append(notes, fmt.Sprintf("⚠️ 一次最多删除 %d 张", maxBulkDelete))
+	}
 
-		finalText := fmt.Sprintf("✅ 处理完成了喵~🐱！\n成功发送: %d 张\n跳过重复: %d 张", successCount, skippedCount)
-		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   finalText,
-		})
+	window := time.Duration(h.Cfg.UndeleteHours) * time.Hour
+	if err := h.DB.PurgeDeleted(window); err != nil {
+		slog.Warn("purge deleted images failed", "err", err)
+	}
 
-		if loadingMsg != nil {
-			b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{
-				ChatID:    update.Message.Chat.ID,
-				MessageID: loadingMsg.ID,
-			})
+	deleted := 0
+	for _, id := range ids {
+		removed, err := h.deleteImage(ctx, id)
+		if err != nil {
+			slog.Error("delete failed", "post_id", id, "err", err)
+			notes = append(notes, fmt.Sprintf("❌ %s: %v", id, err))
+			continue
 		}
-	}()
+		slog.Info("image deleted", "post_id", id, "messages", removed)
+		deleted++
+	}
+	return deleted, notes
 }
 
-func (h *BotHandler) handleYandeLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
-		return
+// deleteImage 软删除一张图并删掉它在各频道的消息，返回删掉的消息数
+func (h *BotHandler) deleteImage(ctx context.Context, postID string) (int, error) {
+	tomb, err := h.DB.SoftDelete(postID)
+	if err != nil {
+		return 0, err
 	}
 
-	go func() {
-		bgCtx := context.Background()
-
-		text := update.Message.Text
-		re := regexp.MustCompile(`post/show/(\d+)`)
-		matches := re.FindStringSubmatch(text)
-		if len(matches) < 2 {
-			return
-		}
-
-		postID := matches[1]
-		pid := fmt.Sprintf("yande_%s", postID)
-
-		if h.DB.CheckExists(pid) {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID:          update.Message.Chat.ID,
-				Text:            "⏭️ 这张图已经发过了哦 (ID: " + pid + ")，跳过。",
-				ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
-			})
-			return
-		}
-
-		loadingMsg, _ := b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:          update.Message.Chat.ID,
-			Text:            "⏳ 正在抓取 Yande ID 了喵~🐱: " + postID + " ...",
-			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
-		})
-
-		post, err := yande.GetYandePost(postID)
-		if err != nil {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "❌ 获取失败: " + err.Error(),
-			})
-			if loadingMsg != nil {
-				b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{ChatID: update.Message.Chat.ID, MessageID: loadingMsg.ID})
+	removed := 0
+	for _, m := range tomb.Messages {
+		for _, msgID := range []int{m.MessageID, m.DocMessageID} {
+			if msgID == 0 {
+				continue
 			}
-			return
-		}
-
-		imgURL := yande.SelectBestURL(post)
-		imgData, err := yande.DownloadYandeImage(imgURL)
-		if err != nil {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "❌ 下载图片失败: " + err.Error(),
-			})
-			if loadingMsg != nil {
-				b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{ChatID: update.Message.Chat.ID, MessageID: loadingMsg.ID})
+			if _, err := h.API.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: m.ChatID, MessageID: msgID}); err != nil {
+				slog.Warn("delete message failed", "chat_id", m.ChatID, "message_id", msgID, "err", err)
+				continue
 			}
-			return
-		}
-
-		tags := strings.ReplaceAll(post.Tags, " ", " #")
-		caption := fmt.Sprintf("Yande: %d\nSize: %dx%d\nTags: #%s",
-			post.ID, post.Width, post.Height, tags)
-
-		h.ProcessAndSend(bgCtx, imgData, pid, post.Tags, caption, "Yande artist", "yande", post.Width, post.Height)
-
-		if loadingMsg != nil {
-			b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{
-				ChatID:    update.Message.Chat.ID,
-				MessageID: loadingMsg.ID,
-			})
+			removed++
 		}
+	}
+	return removed, nil
+}
 
-		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:          update.Message.Chat.ID,
-			Text:            "✅ 处理完成！",
-			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
-		})
-	}()
+// repliedImageID 回复的是频道里的图 (转发过来的或讨论组里的) 时反查图片 ID
+func (h *BotHandler) repliedImageID(msg *models.Message) string {
+	reply := msg.ReplyToMessage
+	if reply == nil {
+		return ""
+	}
+	chatID, msgID := reply.Chat.ID, reply.ID
+	if origin := reply.ForwardOrigin; origin != nil && origin.MessageOriginChannel != nil {
+		chatID, msgID = origin.MessageOriginChannel.Chat.ID, origin.MessageOriginChannel.MessageID
+	}
+	id, err := h.DB.FindByMessage(chatID, msgID)
+	if err != nil {
+		slog.Warn("find image by message failed", "chat_id", chatID, "message_id", msgID, "err", err)
+	}
+	return id
 }
 
-func (h *BotHandler) handleDelete(ctx context.Context, b *bot.Bot, update *models.Update) {
+// handleUndelete /undelete <ID>...，恢复回收站里的记录并按 file_id 重新发回原来的频道
+func (h *BotHandler) handleUndelete(ctx context.Context, b *bot.Bot, update *models.Update) {
 	go func() {
 		bgCtx := context.Background()
 
 		userID := update.Message.From.ID
 		if userID != 8040798522 && userID != 6874581126 {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "⛔ 你没有权限执行删除操作喵~",
-			})
 			return
 		}
 
-		text := update.Message.Text
-		parts := strings.Fields(text)
-		if len(parts) < 2 {
+		ids := strings.Fields(update.Message.Text)[1:]
+		if len(ids) == 0 {
 			b.SendMessage(bgCtx, &bot.SendMessageParams{
 				ChatID: update.Message.Chat.ID,
-				Text:   "⚠️ 格式不对喵🐱！~请输入：/delete <ID>\n例如：/delete pixiv_114514_p0。再输错，小心本喵帮你格式化🐱嗷~",
+				Text:   "⚠️ 格式：/undelete <ID>...\n例如：/undelete pixiv_114514_p0",
 			})
 			return
 		}
 
-		targetID := strings.TrimSpace(parts[1])
+		window := time.Duration(h.Cfg.UndeleteHours) * time.Hour
+		var lines []string
+		for _, id := range ids {
+			tomb, err := h.DB.Undelete(id, window)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("❌ %s: %v", id, err))
+				continue
+			}
 
-		err := h.DB.DeleteImage(targetID)
-		if err != nil {
-			log.Printf("❌ Delete Failed: %v", err)
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   fmt.Sprintf("🐱不好了喵~❌ 删除失败: %v", err),
-			})
-			return
+			meta := tomb.Meta
+			var chats []int64
+			seen := make(map[int64]bool)
+			for _, m := range tomb.Messages {
+				if !seen[m.ChatID] {
+					seen[m.ChatID] = true
+					chats = append(chats, m.ChatID)
+				}
+			}
+			// 旧记录没有副本位置，按现在的分流规则发
+			if len(chats) == 0 {
+				chats = h.routeChats(RouteInfo{Source: meta.Source, Rating: meta.Rating, Tags: meta.TagNames(), Artist: meta.Artist, Width: meta.Width, Height: meta.Height})
+			}
+			h.mirrorCopies(bgCtx, chats, id, meta.FileID, meta.OriginID, meta.Caption, "")
+
+			slog.Info("image restored", "post_id", id)
+			lines = append(lines, "♻️ "+id)
 		}
 
-		log.Printf("🗑️ Image deleted: %s", targetID)
 		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:    update.Message.Chat.ID,
-			Text:      fmt.Sprintf("🗑️🐱Yuki猫猫已经帮主人清理干净了喵~!🐱图片 `%s` 已从数据库移除。", targetID),
-			//ParseMode: models.ParseModeMarkdown,
+			ChatID: update.Message.Chat.ID,
+			Text:   "恢复结果喵~\n" + strings.Join(lines, "\n"),
 		})
 	}()
 }
-
-//func (h *BotHandler) handleFanboxLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-//    if h.Forwarding {
-//        return
-//    }
-
- //   text := update.Message.Text
- //   re := regexp.MustCompile(`fanbox\.cc/@[\w-]+/posts/(\d+)`)
-//    matches := re.FindStringSubmatch(text)
-//    if len(matches) < 2 {
-//        return
-//    }
-
-//    postID := matches[1]
-//    pid := fmt.Sprintf("fanbox_%s", postID)
-
-    // ✅ 先查重
-//    if h.DB.CheckExists(pid) {
-//        b.SendMessage(ctx, &bot.SendMessageParams{
-//            ChatID:             update.Message.Chat.ID,
- //           Text:               "⏭️ Fanbox 这张已经发过了，跳过。",
- //           ReplyParameters:    &models.ReplyParameters{MessageID: update.Message.ID},
-  //      })
-  //      return
-//    }
-
-//    loadingMsg, _ := b.SendMessage(ctx, &bot.SendMessageParams{
-//        ChatID:             update.Message.Chat.ID,
-//        Text:               "⏳ 正在抓取 Fanbox ID: " + postID + " ...",
-//        ReplyParameters:    &models.ReplyParameters{MessageID: update.Message.ID},
-//    })
-
-    // 获取详情
-//    post, err := fanbox.GetFanboxPost(postID, h.Cfg.FanboxCookie)
-//    if err != nil {
-//        b.SendMessage(ctx, &bot.SendMessageParams{
-//            ChatID: update.Message.Chat.ID,
-//           Text:   "❌ Fanbox 获取失败: " + err.Error(),
-//        })
-//        return
-//    }
-
-    // 处理多图
-//    successCount := 0
-//    for i, img := range post.Images {
-//        imgData, err := fanbox.DownloadFanboxImage(img.URL, h.Cfg.FanboxCookie)
-//        if err != nil {
-//            continue
-//        }
-//
-//        caption := fmt.Sprintf("Fanbox: %s [P%d/%d]\nAuthor: %s\nTags: #%s",
-//            post.Title, i+1, len(post.Images),
-//            post.Author,
-//            strings.Join(post.Tags, " #"))
-//
-//        h.ProcessAndSend(ctx, imgData, fmt.Sprintf("%s_p%d", pid, i), 
-//            strings.Join(post.Tags, " "), caption, "fanbox", img.Width, img.Height)
-//        successCount++
-//        time.Sleep(1 * time.Second)
-//    }
-
-    // 6. 完成反馈
-//    if loadingMsg != nil {
-//        b.DeleteMessage(ctx, &bot.DeleteMessageParams{
-//            ChatID:    update.Message.Chat.ID,
-//            MessageID: loadingMsg.ID,
-//        })
-//    }
-	
-//    b.SendMessage(ctx, &bot.SendMessageParams{
-//        ChatID: update.Message.Chat.ID,
-//        Text:   fmt.Sprintf("✅ Fanbox 处理完成！发送 %d 张", successCount),
-//    })
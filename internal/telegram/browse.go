@@ -0,0 +1,167 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"my-bot-go/internal/caption"
+	"my-bot-go/internal/database"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// 浏览按钮的回调数据，「原图」后面跟图片 ID
+const (
+	browseNext     = "browse:next"
+	browseOriginal = "browse:orig:"
+)
+
+// searchTerms 关键词按标签词典换成规范写法，和入库时一致
+func (h *BotHandler) searchTerms(text string) []string {
+	var terms []string
+	for _, t := range strings.Fields(text) {
+		terms = append(terms, h.Tags.Canonical(strings.TrimPrefix(t, "#")))
+	}
+	return terms
+}
+
+// handleBrowse 私聊里的 /random [标签]、/search <关键词>、/artist <作者>、/latest
+// 每次回一张图，点「下一张」接着翻，R-18 的权限和内联搜索一样
+func (h *BotHandler) handleBrowse(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		msg := update.Message
+		if msg.Chat.Type != "private" || msg.From == nil {
+			return
+		}
+
+		reply := func(text string) {
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID:          msg.Chat.ID,
+				Text:            text,
+				ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+			})
+		}
+
+		cmd, arg, _ := strings.Cut(msg.Text, " ")
+		cmd, _, _ = strings.Cut(cmd, "@")
+		arg = strings.TrimSpace(arg)
+
+		q := database.SearchQuery{IncludeR18: h.canSeeR18(msg.From.ID), Limit: 1}
+		switch cmd {
+		case "/random":
+			q.Random = true
+			q.Terms = h.searchTerms(arg)
+		case "/search":
+			if arg == "" {
+				reply("⚠️ 格式：/search <标签/作者/ID>\n例如：/search 初音未来 miku")
+				return
+			}
+			q.Terms = h.searchTerms(arg)
+		case "/artist":
+			if arg == "" {
+				reply("⚠️ 格式：/artist <作者名>")
+				return
+			}
+			q.Artist = arg
+		case "/latest":
+		default:
+			return
+		}
+
+		h.browseMu.Lock()
+		h.browsing[msg.Chat.ID] = q
+		h.browseMu.Unlock()
+
+		if !h.sendBrowse(bgCtx, msg.Chat.ID, q) {
+			reply("🔍 没有找到符合条件的图喵~")
+		}
+	}()
+}
+
+// sendBrowse 按查询发一张图，没有结果时返回 false
+func (h *BotHandler) sendBrowse(ctx context.Context, chatID int64, q database.SearchQuery) bool {
+	found, err := h.DB.SearchImages(q)
+	if err != nil {
+		slog.Warn("browse search failed", "chat_id", chatID, "err", err)
+		return false
+	}
+	if len(found) == 0 {
+		return false
+	}
+	r := found[0]
+
+	var row []models.InlineKeyboardButton
+	row = append(row, models.InlineKeyboardButton{Text: "➡️ Next", CallbackData: browseNext})
+	// callback_data 最长 64 字节，ID 太长就不给原图按钮
+	if r.OriginID != "" && len(browseOriginal+r.PostID) <= 64 {
+		row = append(row, models.InlineKeyboardButton{Text: "📄 Original", CallbackData: browseOriginal + r.PostID})
+	}
+	if r.SourceURL != "" {
+		row = append(row, models.InlineKeyboardButton{Text: "🔗 Source", URL: r.SourceURL})
+	}
+
+	_, err = h.API.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:      chatID,
+		Photo:       &models.InputFileString{Data: r.FileID},
+		Caption:     caption.Truncate(r.Caption, caption.MaxLen),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}},
+	})
+	if err != nil {
+		slog.Warn("browse send failed", "post_id", r.PostID, "chat_id", chatID, "err", err)
+		return false
+	}
+	return true
+}
+
+// handleBrowseButton 「下一张」和「原图」按钮
+func (h *BotHandler) handleBrowseButton(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		q := update.CallbackQuery
+		answer := func(text string) {
+			b.AnswerCallbackQuery(bgCtx, &bot.AnswerCallbackQueryParams{CallbackQueryID: q.ID, Text: text})
+		}
+		chatID, msgID := q.Message.Chat.ID, q.Message.MessageID
+
+		if postID, ok := strings.CutPrefix(q.Data, browseOriginal); ok {
+			meta, err := h.DB.LoadImage(postID)
+			if err != nil || meta.OriginID == "" {
+				answer("⚠️ 这张图没有原图喵~")
+				return
+			}
+			_, err = b.SendDocument(bgCtx, &bot.SendDocumentParams{
+				ChatID:          chatID,
+				Document:        &models.InputFileString{Data: meta.OriginID},
+				ReplyParameters: &models.ReplyParameters{MessageID: msgID},
+			})
+			if err != nil {
+				answer("❌ " + err.Error())
+				return
+			}
+			answer("")
+			return
+		}
+
+		// 查询条件只存在内存里，重启后要重新发指令
+		h.browseMu.Lock()
+		query, ok := h.browsing[chatID]
+		if ok && !query.Random {
+			query.Offset++
+			h.browsing[chatID] = query
+		}
+		h.browseMu.Unlock()
+		if !ok {
+			answer("⚠️ 查询已过期，请重新发送指令喵~")
+			return
+		}
+
+		if !h.sendBrowse(bgCtx, chatID, query) {
+			answer("🔚 已经是最后一张了喵~")
+			return
+		}
+		answer("")
+	}()
+}
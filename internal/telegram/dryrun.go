@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"context"
+
+	"my-bot-go/internal/filter"
+	"my-bot-go/internal/logging"
+)
+
+type dryRunKey struct{}
+
+// WithDryRun 标记这个爬虫的 ctx 只演练
+// 按爬虫而不是按来源判断，cosine 发出来的来源是 pixiv，不能因为 DRY_RUN=pixiv 就被拦下
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// DryRun 这次发送是否只演练：爬虫的 ctx 带了标记，或者 DRY_RUN=true 全部演练 (链接和转发也算)
+func (h *BotHandler) DryRun(ctx context.Context) bool {
+	if v, _ := ctx.Value(dryRunKey{}).(bool); v {
+		return true
+	}
+	return h.Cfg.DryRunFor("all")
+}
+
+// DryRunSkip 演练且没开 DRY_RUN_DOWNLOAD 时，在下载前记下将要处理的作品并返回 true，爬虫直接跳过
+func (h *BotHandler) DryRunSkip(ctx context.Context, meta filter.Meta) bool {
+	if h.Cfg.DryRunDownload || !h.DryRun(ctx) {
+		return false
+	}
+	logging.Post(meta.Source, meta.ID).Info("dry run, would download and send",
+		"artist", meta.Artist, "tags", meta.Tags, "width", meta.Width, "height", meta.Height)
+	return true
+}
@@ -0,0 +1,126 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"my-bot-go/internal/database"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// 可以修改的字段
+var editFields = map[string]bool{"title": true, "artist": true, "tags": true}
+
+// handleEdit /edit <ID> title|artist|tags <内容>，回复频道里的图时可以省略 ID
+// ID 以 _ 或 * 结尾时按前缀匹配，一次改整个作品的所有页
+func (h *BotHandler) handleEdit(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		msg := update.Message
+
+		userID := msg.From.ID
+		if userID != 8040798522 && userID != 6874581126 {
+			return
+		}
+
+		reply := func(text string) {
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID:          msg.Chat.ID,
+				Text:            text,
+				ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+			})
+		}
+
+		rest := strings.TrimSpace(strings.TrimPrefix(msg.Text, "/edit"))
+		id := ""
+		if parts := strings.Fields(rest); len(parts) > 0 && !editFields[strings.ToLower(parts[0])] {
+			id = parts[0]
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, id))
+		}
+		field, value, _ := strings.Cut(rest, " ")
+		field, value = strings.ToLower(field), strings.TrimSpace(value)
+
+		if id == "" {
+			id = h.repliedImageID(msg)
+		}
+		if id == "" || !editFields[field] || (value == "" && field != "tags") {
+			reply("⚠️ 格式：/edit <ID> title|artist|tags <内容>\n例如：/edit pixiv_114514_p0 title 新标题\n整个作品：/edit pixiv_114514_ tags 初音未来 miku\n回复频道里的图时可以省略 ID")
+			return
+		}
+
+		ids, err := h.findByArtworkPrefix(id)
+		if err != nil {
+			reply("❌ 查询失败: " + err.Error())
+			return
+		}
+		if len(ids) == 0 {
+			reply("⚠️ 没有匹配的图喵~")
+			return
+		}
+
+		var lines []string
+		for _, postID := range ids {
+			edited, err := h.editImage(bgCtx, postID, field, value)
+			if err != nil {
+				slog.Warn("edit failed", "post_id", postID, "field", field, "err", err)
+				lines = append(lines, fmt.Sprintf("❌ %s: %v", postID, err))
+				continue
+			}
+			slog.Info("edited", "post_id", postID, "field", field, "messages", edited)
+			lines = append(lines, fmt.Sprintf("✏️ %s (%d 条消息)", postID, edited))
+		}
+		reply("修改结果喵~\n" + strings.Join(lines, "\n"))
+	}()
+}
+
+// editImage 改一个字段，写回 D1 并更新各频道里的说明文字，返回更新成功的消息数
+func (h *BotHandler) editImage(ctx context.Context, postID, field, value string) (int, error) {
+	meta, err := h.DB.LoadImage(postID)
+	if err != nil {
+		return 0, err
+	}
+
+	switch field {
+	case "title":
+		meta.Title = value
+	case "artist":
+		meta.Artist = value
+	case "tags":
+		var names []string
+		for _, t := range strings.Fields(value) {
+			names = append(names, strings.TrimPrefix(t, "#"))
+		}
+		meta.Tags = database.NewTags(database.TagGeneral, names...)
+	}
+	h.normalizeTags(meta)
+	meta.Caption = h.Captions.Plain(*meta)
+
+	if err := h.DB.UpdateImage(*meta); err != nil {
+		return 0, err
+	}
+
+	msgs, err := h.DB.Messages(postID)
+	if err != nil {
+		return 0, err
+	}
+	text, parseMode := h.Captions.Render(*meta)
+	edited := 0
+	for _, m := range msgs {
+		_, err := h.API.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+			ChatID:    m.ChatID,
+			MessageID: m.MessageID,
+			Caption:   text,
+			ParseMode: parseMode,
+		})
+		if err != nil {
+			slog.Warn("edit caption failed", "post_id", postID, "chat_id", m.ChatID, "err", err)
+			continue
+		}
+		edited++
+	}
+	return edited, nil
+}
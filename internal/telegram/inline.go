@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"my-bot-go/internal/caption"
+	"my-bot-go/internal/database"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Telegram 一次最多返回 50 条内联结果
+const inlinePageSize = 50
+
+// handleUpdate 没有被其他 handler 匹配的更新，目前只处理内联查询
+func (h *BotHandler) handleUpdate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.InlineQuery != nil {
+		go h.handleInlineQuery(context.Background(), b, update.InlineQuery)
+	}
+}
+
+// canSeeR18 管理员和 INLINE_R18_USERS 里的用户能搜到 R-18
+func (h *BotHandler) canSeeR18(userID int64) bool {
+	if userID == 8040798522 || userID == 6874581126 {
+		return true
+	}
+	for _, id := range h.Cfg.InlineR18Users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInlineQuery @bot <标签/作者/ID>，用存下来的 file_id 返回图片，按 offset 翻页
+func (h *BotHandler) handleInlineQuery(ctx context.Context, b *bot.Bot, q *models.InlineQuery) {
+	offset, _ := strconv.Atoi(q.Offset)
+
+	terms := h.searchTerms(q.Query)
+	includeR18 := q.From != nil && h.canSeeR18(q.From.ID)
+	found, err := h.DB.SearchImages(database.SearchQuery{Terms: terms, IncludeR18: includeR18, Limit: inlinePageSize, Offset: offset})
+	if err != nil {
+		slog.Warn("inline search failed", "query", q.Query, "err", err)
+		return
+	}
+
+	results := make([]models.InlineQueryResult, 0, len(found))
+	for _, r := range found {
+		results = append(results, &models.InlineQueryResultCachedPhoto{
+			ID:          r.PostID,
+			PhotoFileID: r.FileID,
+			Title:       r.PostID,
+			Description: r.Artist,
+			Caption:     caption.Truncate(r.Caption, caption.MaxLen),
+		})
+	}
+
+	nextOffset := ""
+	if len(found) == inlinePageSize {
+		nextOffset = strconv.Itoa(offset + inlinePageSize)
+	}
+
+	_, err = b.AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+		InlineQueryID: q.ID,
+		Results:       results,
+		CacheTime:     30,
+		IsPersonal:    true, // 能不能看到 R-18 因人而异
+		NextOffset:    nextOffset,
+	})
+	if err != nil {
+		slog.Warn("answer inline query failed", "query", q.Query, "err", err)
+	}
+}
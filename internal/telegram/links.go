@@ -0,0 +1,228 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/fanbox"
+	"my-bot-go/internal/manyacg"
+	"my-bot-go/internal/pixiv"
+	"my-bot-go/internal/rating"
+	"my-bot-go/internal/twitter"
+)
+
+var (
+	pixivLinkRe   = regexp.MustCompile(`pixiv\.net/(?:en/)?artworks/(\d+)`)
+	manyacgLinkRe = regexp.MustCompile(`manyacg\.top/artwork/[a-zA-Z0-9]+`)
+	// 域名前必须是开头、/、. 或空白，dropbox.com、netflix.com 之类不算
+	twitterLinkRe = regexp.MustCompile(`(?:^|[/.\s])((?:x|twitter)\.com/\w+/status/\d+)`)
+)
+
+// FetchLink 不经过聊天直接处理一个链接，返回处理它的站点名，命令行的 bot fetch 用
+func (h *BotHandler) FetchLink(ctx context.Context, url string) (name string, sent int, skipped int, err error) {
+	for _, l := range h.links {
+		if l.re.MatchString(url) {
+			sent, skipped, err = l.fn(ctx, url)
+			return l.name, sent, skipped, err
+		}
+	}
+	return "", 0, 0, fmt.Errorf("unsupported link: %s", url)
+}
+
+func (h *BotHandler) fetchPixivLink(ctx context.Context, text string) (int, int, error) {
+	matches := pixivLinkRe.FindStringSubmatch(text)
+	if len(matches) < 2 {
+		return 0, 0, fmt.Errorf("invalid pixiv url")
+	}
+
+	illust, err := pixiv.GetIllust(matches[1], h.Cfg.PixivPHPSESSID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, skipped := 0, 0
+	for i, page := range illust.Pages {
+		pid := fmt.Sprintf("pixiv_%s_p%d", illust.ID, i)
+		if h.DB.CheckExists(pid) {
+			skipped++
+			continue
+		}
+		imgData, err := pixiv.DownloadImage(page.Urls.Original, h.Cfg.PixivPHPSESSID)
+		if err != nil {
+			slog.Warn("download failed", "source", "pixiv", "post_id", pid, "page", i, "err", err)
+			continue
+		}
+		h.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "pixiv",
+			SourceURL: "https://www.pixiv.net/artworks/" + illust.ID,
+			PageCount: len(illust.Pages),
+			Title:     illust.Title,
+			ArtistID:  illust.ArtistID,
+			Artist:    illust.Artist,
+			Rating:    illust.Rating,
+			Tags:      database.NewTags(database.TagGeneral, illust.TagList...),
+			Width:     page.Width,
+			Height:    page.Height,
+		})
+		sent++
+		time.Sleep(1 * time.Second)
+	}
+	return sent, skipped, nil
+}
+
+func (h *BotHandler) fetchManyacgLink(ctx context.Context, text string) (int, int, error) {
+	artworkURL := manyacgLinkRe.FindString(text)
+	if artworkURL == "" {
+		return 0, 0, fmt.Errorf("invalid manyacg url")
+	}
+
+	artwork, err := manyacg.GetArtworkInfo(artworkURL)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, skipped := 0, 0
+	for i, pic := range artwork.Pictures {
+		pid := fmt.Sprintf("mtcacg_%s_p%d", artwork.ID, i)
+		if h.DB.CheckExists(pid) {
+			skipped++
+			continue
+		}
+		imgData, err := manyacg.DownloadOriginal(ctx, pic.ID)
+		if err != nil {
+			slog.Warn("download failed", "source", "mtcacg", "post_id", pid, "page", i, "err", err)
+			continue
+		}
+		h.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "manyacg",
+			SourceURL: artwork.SourceURL,
+			PageCount: len(artwork.Pictures),
+			Title:     artwork.Title,
+			ArtistID:  artwork.Artist.ID,
+			Artist:    artwork.Artist.Name,
+			Rating:    rating.FromFlag(artwork.R18),
+			Tags:      database.NewTags(database.TagGeneral, artwork.Tags...),
+			Width:     pic.Width,
+			Height:    pic.Height,
+		})
+		sent++
+		time.Sleep(1 * time.Second)
+	}
+	return sent, skipped, nil
+}
+
+func (h *BotHandler) fetchTwitterLink(ctx context.Context, text string) (int, int, error) {
+	matches := twitterLinkRe.FindStringSubmatch(text)
+	if len(matches) < 2 {
+		return 0, 0, fmt.Errorf("invalid tweet url")
+	}
+	tweetURL := matches[1]
+	if h.Cfg.TwitterCookie == "" {
+		return 0, 0, fmt.Errorf("还没有配置 TWITTER_COOKIE 哦，没法抓取推文喵~")
+	}
+
+	tweet, err := twitter.GetTweetWithCookie(tweetURL, h.Cfg.TwitterCookie, h.Cfg.TwitterCT0, h.Cfg.TwitterQueryID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, skipped := 0, 0
+	for i, photo := range tweet.Photos {
+		pid := fmt.Sprintf("twitter_%s_p%d", tweet.ID, i)
+		if h.DB.CheckExists(pid) {
+			skipped++
+			continue
+		}
+		imgData, err := twitter.DownloadImage(photo.URL, h.Cfg.TwitterCookie)
+		if err != nil {
+			slog.Warn("download failed", "source", "twitter", "post_id", pid, "url", photo.URL, "err", err)
+			continue
+		}
+		h.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    pid,
+			Source:    "twitter",
+			SourceURL: tweet.URL(),
+			PageCount: len(tweet.Photos),
+			Title:     tweet.Title(),
+			ArtistID:  tweet.Author,
+			Artist:    tweet.Author,
+			Rating:    rating.FromFlag(tweet.Sensitive),
+			Tags:      database.NewTags(database.TagGeneral, tweet.Hashtags...),
+			Width:     photo.Width,
+			Height:    photo.Height,
+		})
+		sent++
+		time.Sleep(1 * time.Second)
+	}
+	return sent, skipped, nil
+}
+
+func (h *BotHandler) fetchFanboxLink(ctx context.Context, text string) (int, int, error) {
+	postID, err := fanbox.ParsePostID(text)
+	if err != nil {
+		return 0, 0, err
+	}
+	if h.Cfg.FanboxCookie == "" {
+		return 0, 0, fmt.Errorf("还没有配置 FANBOX_COOKIE 哦，没法抓取 Fanbox 喵~")
+	}
+	pid := "fanbox_" + postID
+	if h.DB.CheckExists(pid) {
+		return 0, 1, nil
+	}
+
+	post, err := fanbox.GetFanboxPost(postID, h.Cfg.FanboxCookie)
+	if errors.Is(err, fanbox.ErrRestricted) {
+		return 0, 0, fmt.Errorf("🔒 这篇需要 ¥%d 档位的赞助才能看喵~，当前 Cookie 的档位不够", post.FeeRequired)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, skipped, failed := 0, 0, false
+	for i, img := range post.Images {
+		subPid := fmt.Sprintf("%s_p%d", pid, i)
+		if h.DB.CheckExists(subPid) {
+			skipped++
+			continue
+		}
+		imgData, err := fanbox.DownloadFanboxImage(img.URL, h.Cfg.FanboxCookie)
+		if err != nil {
+			slog.Warn("download failed", "source", "fanbox", "post_id", subPid, "url", img.URL, "err", err)
+			failed = true
+			continue
+		}
+		width, height := fanbox.DecodeSize(img, imgData)
+
+		if !h.ProcessAndSend(ctx, imgData, database.ImageMeta{
+			PostID:    subPid,
+			Source:    "fanbox",
+			SourceURL: fmt.Sprintf("https://%s.fanbox.cc/posts/%s", post.CreatorID, post.ID),
+			PageCount: len(post.Images),
+			Title:     post.Title,
+			ArtistID:  post.CreatorID,
+			Artist:    post.Author,
+			Rating:    rating.FromFlag(post.Adult),
+			Tags:      database.NewTags(database.TagGeneral, post.Tags...),
+			Width:     width,
+			Height:    height,
+		}) {
+			failed = true
+			continue
+		}
+		sent++
+		time.Sleep(1 * time.Second)
+	}
+	// 和爬虫一样记下整篇帖子，之后不再重抓
+	if !failed && !h.DryRun(ctx) {
+		h.DB.MarkHistory(pid)
+		h.DB.PushHistory()
+	}
+	return sent, skipped, nil
+}
@@ -0,0 +1,295 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"my-bot-go/internal/caption"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/rating"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// 审核按钮的回调数据，待审内容按审核消息 ID 存在 D1 的 review_queue 表，重启后按钮依然有效
+const (
+	reviewApprove = "review:approve"
+	reviewReject  = "review:reject"
+	reviewR18     = "review:r18"
+	reviewTags    = "review:tags"
+)
+
+func reviewKeyboard() *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{{Text: "✅ Approve", CallbackData: reviewApprove}, {Text: "❌ Reject", CallbackData: reviewReject}},
+		{{Text: "🔞 Mark R-18", CallbackData: reviewR18}, {Text: "🏷 Edit tags", CallbackData: reviewTags}},
+	}}
+}
+
+// needsReview 配置了 REVIEW_CHAT_ID 且来源在 REVIEW_SOURCES 里 (留空为全部)
+func (h *BotHandler) needsReview(source string) bool {
+	if h.Cfg.ReviewChatID == 0 {
+		return false
+	}
+	return len(h.Cfg.ReviewSources) == 0 || containsFold(h.Cfg.ReviewSources, source)
+}
+
+// reviewCaption 审核群里只用纯文本，附上 ID 和分级方便判断
+func (h *BotHandler) reviewCaption(meta database.ImageMeta) string {
+	return caption.Truncate(h.Captions.Plain(meta), 900) + fmt.Sprintf("\n\n🆔 %s\n⭐ %s", meta.PostID, meta.Rating)
+}
+
+// sendToReview 把预览图和原图发到审核群，记下 file_id，等管理员点按钮，送审失败返回 false
+func (h *BotHandler) sendToReview(ctx context.Context, photo, original []byte, meta database.ImageMeta) bool {
+	msg, err := h.API.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:      h.Cfg.ReviewChatID,
+		Photo:       &models.InputFileUpload{Filename: meta.Source + ".jpg", Data: bytes.NewReader(photo)},
+		Caption:     h.reviewCaption(meta),
+		ReplyMarkup: reviewKeyboard(),
+	})
+	if err != nil {
+		slog.Error("review send failed", "source", meta.Source, "post_id", meta.PostID, "err", err)
+		return false
+	}
+	if len(msg.Photo) == 0 {
+		return false
+	}
+	meta.FileID = msg.Photo[len(msg.Photo)-1].FileID
+
+	docMsg, err := h.API.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:          h.Cfg.ReviewChatID,
+		Document:        &models.InputFileUpload{Filename: meta.Source + "_original.jpg", Data: bytes.NewReader(original)},
+		ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+		Caption:         "⬇️ Original File",
+	})
+	if err != nil {
+		slog.Warn("review send original failed, will only publish preview", "source", meta.Source, "post_id", meta.PostID, "err", err)
+	} else {
+		meta.OriginID = docMsg.Document.FileID
+	}
+
+	if err := h.DB.SaveReview(msg.ID, meta); err != nil {
+		slog.Error("d1 save review failed", "source", meta.Source, "post_id", meta.PostID, "err", err)
+		return false
+	}
+	// 审核期间也算发过，避免下一轮巡逻再送审一次
+	h.DB.MarkHistory(meta.PostID)
+	slog.Info("queued for review", "source", meta.Source, "post_id", meta.PostID)
+	return true
+}
+
+// publishReviewed 审核通过后用 file_id 发到目标频道并入库
+func (h *BotHandler) publishReviewed(ctx context.Context, meta database.ImageMeta) error {
+	chats := h.routeChats(RouteInfo{Source: meta.Source, Rating: meta.Rating, Tags: meta.TagNames(), Artist: meta.Artist, Width: meta.Width, Height: meta.Height})
+	text, parseMode := h.Captions.Render(meta)
+
+	msg, err := h.API.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:    chats[0],
+		Photo:     &models.InputFileString{Data: meta.FileID},
+		Caption:   text,
+		ParseMode: parseMode,
+	})
+	if err != nil {
+		return err
+	}
+	if len(msg.Photo) > 0 {
+		meta.FileID = msg.Photo[len(msg.Photo)-1].FileID
+	}
+
+	docMsgID := 0
+	if meta.OriginID != "" {
+		docMsg, err := h.API.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:          chats[0],
+			Document:        &models.InputFileString{Data: meta.OriginID},
+			ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+			Caption:         "⬇️ Original File",
+		})
+		if err != nil {
+			slog.Warn("send original failed, will only save preview", "source", meta.Source, "post_id", meta.PostID, "err", err)
+		} else {
+			meta.OriginID = docMsg.Document.FileID
+			docMsgID = docMsg.ID
+		}
+	}
+
+	meta.Caption = h.Captions.Plain(meta)
+	if err := h.DB.SaveImage(meta); err != nil {
+		return err
+	}
+	metrics.Count(meta.Source, metrics.Sent)
+	slog.Info("approved", "source", meta.Source, "post_id", meta.PostID)
+
+	h.recordMessage(meta.PostID, chats[0], msg.ID, docMsgID)
+	h.mirrorCopies(ctx, chats[1:], meta.PostID, meta.FileID, meta.OriginID, text, parseMode)
+	return nil
+}
+
+// lockReview 同一条待审内容同时只处理一次，防止连点两下发两遍
+func (h *BotHandler) lockReview(messageID int) bool {
+	h.reviewMu.Lock()
+	defer h.reviewMu.Unlock()
+	if h.reviewing[messageID] {
+		return false
+	}
+	h.reviewing[messageID] = true
+	return true
+}
+
+func (h *BotHandler) unlockReview(messageID int) {
+	h.reviewMu.Lock()
+	delete(h.reviewing, messageID)
+	h.reviewMu.Unlock()
+}
+
+func (h *BotHandler) handleReview(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		q := update.CallbackQuery
+		answer := func(text string) {
+			b.AnswerCallbackQuery(bgCtx, &bot.AnswerCallbackQueryParams{CallbackQueryID: q.ID, Text: text})
+		}
+
+		userID := q.From.ID
+		if userID != 8040798522 && userID != 6874581126 {
+			answer("⛔ 你没有权限审核喵~")
+			return
+		}
+
+		chatID, msgID := q.Message.Chat.ID, q.Message.MessageID
+		if !h.lockReview(msgID) {
+			answer("⏳ 正在处理中喵~")
+			return
+		}
+		defer h.unlockReview(msgID)
+
+		meta, err := h.DB.GetReview(msgID)
+		if err != nil || meta == nil {
+			answer("⚠️ 找不到这条待审内容，可能已经处理过了")
+			return
+		}
+
+		switch q.Data {
+		case reviewApprove:
+			if err := h.publishReviewed(bgCtx, *meta); err != nil {
+				slog.Error("publish reviewed failed", "source", meta.Source, "post_id", meta.PostID, "err", err)
+				answer("❌ 发布失败: " + err.Error())
+				return
+			}
+			h.finishReview(bgCtx, chatID, msgID, *meta, "✅ 已发布")
+			answer("✅ 已发布")
+
+		case reviewReject:
+			// 拒绝的 ID 留在 History 里，以后不会再爬
+			h.DB.MarkHistory(meta.PostID)
+			h.DB.PushHistory()
+			h.finishReview(bgCtx, chatID, msgID, *meta, "❌ 已拒绝")
+			slog.Info("rejected", "source", meta.Source, "post_id", meta.PostID)
+			answer("❌ 已拒绝")
+
+		case reviewR18:
+			meta.Rating = rating.Explicit
+			h.normalizeTags(meta)
+			if err := h.updateReview(bgCtx, chatID, msgID, *meta); err != nil {
+				answer("❌ 保存失败: " + err.Error())
+				return
+			}
+			answer("🔞 已标记为 R-18")
+
+		case reviewTags:
+			prompt, err := b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				Text:            "🏷 回复这条消息输入新的标签 (空格分隔) 喵~\n当前: " + strings.Join(meta.TagNames(), " "),
+				ReplyParameters: &models.ReplyParameters{MessageID: msgID},
+				ReplyMarkup:     &models.ForceReply{ForceReply: true, Selective: true},
+			})
+			if err != nil {
+				answer("❌ " + err.Error())
+				return
+			}
+			h.reviewMu.Lock()
+			h.tagEdits[prompt.ID] = msgID
+			h.reviewMu.Unlock()
+			answer("")
+		}
+	}()
+}
+
+// handleTagReply 处理对「编辑标签」提示的回复，不是这类回复时返回 false
+func (h *BotHandler) handleTagReply(b *bot.Bot, msg *models.Message) bool {
+	if msg.ReplyToMessage == nil {
+		return false
+	}
+	h.reviewMu.Lock()
+	defer h.reviewMu.Unlock()
+	reviewMsgID, ok := h.tagEdits[msg.ReplyToMessage.ID]
+	if !ok {
+		return false
+	}
+	// 别人的回复不算，提示继续有效
+	if msg.From == nil || (msg.From.ID != 8040798522 && msg.From.ID != 6874581126) {
+		return true
+	}
+	delete(h.tagEdits, msg.ReplyToMessage.ID)
+
+	go func() {
+		bgCtx := context.Background()
+
+		meta, err := h.DB.GetReview(reviewMsgID)
+		if err != nil || meta == nil {
+			b.SendMessage(bgCtx, &bot.SendMessageParams{ChatID: msg.Chat.ID, Text: "⚠️ 找不到这条待审内容，可能已经处理过了"})
+			return
+		}
+
+		var names []string
+		for _, t := range strings.Fields(msg.Text) {
+			names = append(names, strings.TrimPrefix(t, "#"))
+		}
+		meta.Tags = database.NewTags(database.TagGeneral, names...)
+		h.normalizeTags(meta)
+
+		text := "✅ 标签已更新喵~"
+		if err := h.updateReview(bgCtx, msg.Chat.ID, reviewMsgID, *meta); err != nil {
+			text = "❌ 保存失败: " + err.Error()
+		}
+		b.SendMessage(bgCtx, &bot.SendMessageParams{
+			ChatID:          msg.Chat.ID,
+			Text:            text,
+			ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+		})
+	}()
+	return true
+}
+
+// updateReview 保存修改并刷新审核消息，按钮保留
+func (h *BotHandler) updateReview(ctx context.Context, chatID int64, msgID int, meta database.ImageMeta) error {
+	if err := h.DB.SaveReview(msgID, meta); err != nil {
+		return err
+	}
+	_, err := h.API.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+		ChatID:      chatID,
+		MessageID:   msgID,
+		Caption:     h.reviewCaption(meta),
+		ReplyMarkup: reviewKeyboard(),
+	})
+	if err != nil {
+		slog.Warn("edit review caption failed", "post_id", meta.PostID, "err", err)
+	}
+	return nil
+}
+
+// finishReview 移出队列，审核消息去掉按钮并标上结果
+func (h *BotHandler) finishReview(ctx context.Context, chatID int64, msgID int, meta database.ImageMeta, status string) {
+	if err := h.DB.DeleteReview(msgID); err != nil {
+		slog.Warn("d1 delete review failed", "post_id", meta.PostID, "err", err)
+	}
+	h.API.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+		ChatID:    chatID,
+		MessageID: msgID,
+		Caption:   h.reviewCaption(meta) + "\n\n" + status,
+	})
+}
@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"strings"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/rating"
+)
+
+// RouteInfo 分流时用到的作品信息
+type RouteInfo struct {
+	Source string
+	Rating string
+	Tags   []string
+	Artist string
+	Width  int
+	Height int
+}
+
+// routeChats 按 ROUTE_RULES 计算要发送的频道，第一个是主频道，其余是镜像
+func (h *BotHandler) routeChats(info RouteInfo) []int64 {
+	var primary, mirrors []int64
+	for _, rule := range h.Cfg.RouteRules {
+		if !matchRule(rule, info) {
+			continue
+		}
+		if rule.Mirror {
+			mirrors = append(mirrors, rule.Chats...)
+			continue
+		}
+		if primary == nil {
+			primary = rule.Chats
+		}
+	}
+	if primary == nil {
+		primary = []int64{h.targetChannel(info.Rating)}
+	}
+
+	// 去重，防止多条规则指向同一个频道时重复发送
+	seen := make(map[int64]bool)
+	var chats []int64
+	for _, id := range append(append([]int64{}, primary...), mirrors...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		chats = append(chats, id)
+	}
+	return chats
+}
+
+func matchRule(rule config.RouteRule, info RouteInfo) bool {
+	if len(rule.Sources) > 0 && !containsFold(rule.Sources, info.Source) {
+		return false
+	}
+	if len(rule.Ratings) > 0 && !containsFold(rule.Ratings, rating.Normalize(info.Rating, rating.Safe)) {
+		return false
+	}
+	if len(rule.Artists) > 0 && !containsFold(rule.Artists, info.Artist) {
+		return false
+	}
+	if len(rule.Tags) > 0 {
+		hit := false
+		for _, t := range info.Tags {
+			if containsFold(rule.Tags, strings.TrimPrefix(t, "#")) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+
+	if rule.Aspect != "" || rule.MinRatio > 0 {
+		// 没有宽高的图无法判断比例，直接不命中
+		if info.Width <= 0 || info.Height <= 0 {
+			return false
+		}
+		ratio := float64(info.Width) / float64(info.Height)
+		switch rule.Aspect {
+		case "landscape":
+			if ratio <= 1.1 {
+				return false
+			}
+		case "portrait":
+			if ratio >= 0.9 {
+				return false
+			}
+		case "square":
+			if ratio < 0.9 || ratio > 1.1 {
+				return false
+			}
+		}
+		if rule.MinRatio > 0 && ratio < rule.MinRatio {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
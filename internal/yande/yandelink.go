@@ -15,41 +15,11 @@ type YandePostLink struct {
 	FileURL   string `json:"file_url"`
 	FileSize  int    `json:"file_size"`
 	Tags      string `json:"tags"`
+	Rating    string `json:"rating"` // s / q / e
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
 }
 
-//根据 ID 获取图片详情
-func GetYandePost(id string) (*YandePostLink, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	
-	url := fmt.Sprintf("https://yande.re/post.json?tags=id:%s", id)
-	
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API status code: %d", resp.StatusCode)
-	}
-
-	var posts []YandePostLink
-	if err := json.NewDecoder(resp.Body).Decode(&posts); err != nil {
-		return nil, err
-	}
-
-	if len(posts) == 0 {
-		return nil, fmt.Errorf("post not found: %s", id)
-	}
-
-	return &posts[0], nil
-}
-
 // 下载图片数据
 func DownloadYandeImage(url string) ([]byte, error) {
 	client := &http.Client{Timeout: 60 * time.Second}
@@ -83,3 +53,68 @@ func SelectBestURL(post *YandePostLink) string {
 	}
 	return post.FileURL
 }
+
+type YandePool struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	PostCount int             `json:"post_count"`
+	Posts     []YandePostLink `json:"posts"`
+}
+
+// GetYandePool 获取图集 (pool) 的全部帖子，按图集顺序排列，自动翻页
+func GetYandePool(id string) (*YandePool, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var pool *YandePool
+	seen := make(map[int]bool)
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://yande.re/pool/show.json?id=%s&page=%d", id, page)
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("API status code: %d", resp.StatusCode)
+		}
+
+		var current YandePool
+		err = json.NewDecoder(resp.Body).Decode(&current)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if pool == nil {
+			pool = &YandePool{ID: current.ID, Name: current.Name, PostCount: current.PostCount}
+		}
+
+		added := 0
+		for _, p := range current.Posts {
+			if seen[p.ID] {
+				continue
+			}
+			seen[p.ID] = true
+			pool.Posts = append(pool.Posts, p)
+			added++
+		}
+
+		// 没有新数据 (翻到底，或接口忽略了 page 参数) 就停
+		if added == 0 || len(pool.Posts) >= pool.PostCount {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	if pool == nil || pool.ID == 0 {
+		return nil, fmt.Errorf("pool not found: %s", id)
+	}
+
+	return pool, nil
+}